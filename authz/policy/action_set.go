@@ -4,13 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/minio/minio-go/pkg/set"
-	"github.com/minio/minio/pkg/wildcard"
 	"github.com/thatique/awan/authz/authorizer"
 )
 
-// ActionSet - set of actions.
+// CanonicalAction returns the form actions are compared in: trimmed and lower
+// cased, so "getobject" and " GetObject" both match "GetObject".
+func CanonicalAction(action authorizer.Action) authorizer.Action {
+	return authorizer.Action(strings.Map(unicode.ToLower, strings.TrimSpace(string(action))))
+}
+
+// ActionSet - set of actions. Actions are kept as written but matched on
+// their CanonicalAction, so matching is case insensitive.
 type ActionSet map[authorizer.Action]struct{}
 
 // Add add an action to action set
@@ -20,8 +28,9 @@ func (actionSet ActionSet) Add(action authorizer.Action) {
 
 // Match - matches object name with anyone of action pattern in action set.
 func (actionSet ActionSet) Match(action authorizer.Action) bool {
+	name := strings.TrimSpace(string(action))
 	for r := range actionSet {
-		if wildcard.Match(string(r), string(action)) {
+		if compileMatcher(strings.TrimSpace(string(r)), true).match(name) {
 			return true
 		}
 	}
@@ -29,11 +38,17 @@ func (actionSet ActionSet) Match(action authorizer.Action) bool {
 	return false
 }
 
-// Intersection - returns actions available in both ActionSet.
+// Intersection - returns actions available in both ActionSet, compared on
+// their CanonicalAction.
 func (actionSet ActionSet) Intersection(sset ActionSet) ActionSet {
+	canonical := make(map[authorizer.Action]struct{}, len(sset))
+	for k := range sset {
+		canonical[CanonicalAction(k)] = struct{}{}
+	}
+
 	nset := NewActionSet()
 	for k := range actionSet {
-		if _, ok := sset[k]; ok {
+		if _, ok := canonical[CanonicalAction(k)]; ok {
 			nset.Add(k)
 		}
 	}
@@ -41,6 +56,12 @@ func (actionSet ActionSet) Intersection(sset ActionSet) ActionSet {
 	return nset
 }
 
+// Equals - returns true if both ActionSet hold the same actions, compared on
+// their CanonicalAction.
+func (actionSet ActionSet) Equals(sset ActionSet) bool {
+	return len(actionSet) == len(sset) && len(actionSet.Intersection(sset)) == len(actionSet)
+}
+
 // MarshalJSON - encodes ActionSet to JSON data.
 func (actionSet ActionSet) MarshalJSON() ([]byte, error) {
 	if len(actionSet) == 0 {
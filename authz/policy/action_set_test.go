@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thatique/awan/auth/user"
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+func TestActionSetMatchCaseInsensitive(t *testing.T) {
+	var actionSet ActionSet
+	if err := json.Unmarshal([]byte(`["getobject", "Put*", "LISTBUCKET"]`), &actionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		action   authorizer.Action
+		expected bool
+	}{
+		{"GetObject", true},
+		{"getobject", true},
+		{"GETOBJECT", true},
+		{" GetObject ", true},
+		{"PutObject", true},
+		{"putobjectacl", true},
+		{"ListBucket", true},
+		{"DeleteObject", false},
+	}
+
+	for i, testCase := range testCases {
+		if got := actionSet.Match(testCase.action); got != testCase.expected {
+			t.Errorf("case %d: Match(%q) expected %v, got %v", i+1, testCase.action, testCase.expected, got)
+		}
+	}
+}
+
+func TestActionSetIntersectionCaseInsensitive(t *testing.T) {
+	a := NewActionSet("GetObject", "PutObject")
+	b := NewActionSet("getobject", "DeleteObject")
+
+	if got := a.Intersection(b); len(got) != 1 || !got.Match("GetObject") {
+		t.Errorf("expected GetObject in the intersection, got %v", got)
+	}
+}
+
+func TestCanonicalAction(t *testing.T) {
+	if got := CanonicalAction(" GetObject"); got != "getobject" {
+		t.Errorf("expected %q, got %q", "getobject", got)
+	}
+}
+
+func TestSetLiterals(t *testing.T) {
+	if !(ActionSet{"GetObject": {}}).Match("getobject") {
+		t.Error("expected an ActionSet literal to match")
+	}
+	if !(ResourceSet{"mybucket/*": {}}).Match("mybucket/key") {
+		t.Error("expected a ResourceSet literal to match")
+	}
+	if !(PrincipalSet{"ali*": {}}).Match(&user.DefaultInfo{Name: "alice"}) {
+		t.Error("expected a PrincipalSet literal to match")
+	}
+}
@@ -0,0 +1,172 @@
+// Package condition provides the condition operators usable in the Condition
+// block of a policy statement.
+package condition
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CurrentTime is the key holding the time of the request, as an RFC3339
+// date. The policy evaluator always sets it from its own clock, overriding the
+// request's Metadata, so DateLessThan and DateGreaterThan can limit a
+// statement in time.
+const CurrentTime = "aws:CurrentTime"
+
+// Function is a condition operator applied to the values of a key
+type Function interface {
+	// evaluate the function against the request's condition values
+	evaluate(values map[string][]string) bool
+
+	// name of the operator, e.g. StringEquals
+	name() string
+
+	// key the function is applied to
+	key() string
+
+	// values of the function, as written in the policy
+	values() []string
+}
+
+// Functions is a set of condition functions, all of them must hold for the
+// conditions to be satisfied
+type Functions []Function
+
+// NewFunctions creates a new set of functions
+func NewFunctions(functions ...Function) Functions {
+	return Functions(functions)
+}
+
+// Evaluate returns true if every function holds for the given values. An empty
+// set of functions always holds.
+func (functions Functions) Evaluate(values map[string][]string) bool {
+	for _, f := range functions {
+		if !f.evaluate(values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals returns true if both sets hold the same functions, in any order
+func (functions Functions) Equals(other Functions) bool {
+	if len(functions) != len(other) {
+		return false
+	}
+	a, errA := functions.MarshalJSON()
+	b, errB := other.MarshalJSON()
+
+	return errA == nil && errB == nil && string(a) == string(b)
+}
+
+// Keys returns the sorted keys used by the functions
+func (functions Functions) Keys() []string {
+	seen := make(map[string]struct{})
+	keys := []string{}
+	for _, f := range functions {
+		if _, ok := seen[f.key()]; !ok {
+			seen[f.key()] = struct{}{}
+			keys = append(keys, f.key())
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// MarshalJSON - encodes Functions to JSON data.
+func (functions Functions) MarshalJSON() ([]byte, error) {
+	nm := make(map[string]map[string][]string)
+	for _, f := range functions {
+		if _, ok := nm[f.name()]; !ok {
+			nm[f.name()] = make(map[string][]string)
+		}
+		nm[f.name()][f.key()] = append(nm[f.name()][f.key()], f.values()...)
+	}
+
+	return json.Marshal(nm)
+}
+
+// UnmarshalJSON - decodes JSON data to Functions.
+func (functions *Functions) UnmarshalJSON(data []byte) error {
+	var nm map[string]map[string]valueList
+	if err := json.Unmarshal(data, &nm); err != nil {
+		return err
+	}
+
+	if len(nm) == 0 {
+		*functions = nil
+		return nil
+	}
+
+	// sorted so the functions order is stable
+	names := make([]string, 0, len(nm))
+	for name := range nm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fs := Functions{}
+	for _, name := range names {
+		newFunc, ok := operators[name]
+		if !ok {
+			return fmt.Errorf("unknown condition operator %v", name)
+		}
+
+		keys := make([]string, 0, len(nm[name]))
+		for key := range nm[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			f, err := newFunc(key, nm[name][key]...)
+			if err != nil {
+				return err
+			}
+			fs = append(fs, f)
+		}
+	}
+
+	*functions = fs
+
+	return nil
+}
+
+// valueList decodes a single JSON scalar or a list of scalars to strings
+type valueList []string
+
+func (vl *valueList) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var v interface{}
+		if err = json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		raw = []interface{}{v}
+	}
+
+	values := make(valueList, 0, len(raw))
+	for _, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values = append(values, v)
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("invalid condition value %v", v)
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("condition values must not be empty")
+	}
+
+	*vl = values
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package condition
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustFunc(f Function, err error) Function {
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func TestFunctionEvaluate(t *testing.T) {
+	testCases := []struct {
+		f        Function
+		values   map[string][]string
+		expected bool
+	}{
+		{mustFunc(NewStringEqualsFunc("team", "dev", "ops")), map[string][]string{"team": {"ops"}}, true},
+		{mustFunc(NewStringEqualsFunc("team", "dev", "ops")), map[string][]string{"team": {"sales"}}, false},
+		{mustFunc(NewStringEqualsFunc("team", "dev")), map[string][]string{}, false},
+		{mustFunc(NewStringNotEqualsFunc("team", "dev")), map[string][]string{"team": {"ops"}}, true},
+		{mustFunc(NewStringNotEqualsFunc("team", "dev")), map[string][]string{"team": {"dev"}}, false},
+		{mustFunc(NewStringNotEqualsFunc("team", "dev")), map[string][]string{}, true},
+		{mustFunc(NewStringLikeFunc("prefix", "home/*")), map[string][]string{"prefix": {"home/alice"}}, true},
+		{mustFunc(NewStringLikeFunc("prefix", "home/*")), map[string][]string{"prefix": {"tmp/alice"}}, false},
+		{mustFunc(NewNumericEqualsFunc("max-keys", "10")), map[string][]string{"max-keys": {"10"}}, true},
+		{mustFunc(NewNumericEqualsFunc("max-keys", "10")), map[string][]string{"max-keys": {"ten"}}, false},
+		{mustFunc(NewNumericLessThanFunc("max-keys", "10")), map[string][]string{"max-keys": {"9"}}, true},
+		{mustFunc(NewNumericLessThanFunc("max-keys", "10")), map[string][]string{"max-keys": {"10"}}, false},
+		{mustFunc(NewNumericGreaterThanFunc("max-keys", "10")), map[string][]string{"max-keys": {"11.5"}}, true},
+		{mustFunc(NewNumericGreaterThanFunc("max-keys", "10")), map[string][]string{"max-keys": {"2"}}, false},
+		{mustFunc(NewDateLessThanFunc("now", "2020-01-01T00:00:00Z")), map[string][]string{"now": {"2019-12-31T23:59:59Z"}}, true},
+		{mustFunc(NewDateLessThanFunc("now", "2020-01-01T00:00:00Z")), map[string][]string{"now": {"2020-01-02T00:00:00Z"}}, false},
+		{mustFunc(NewDateGreaterThanFunc("now", "2020-01-01T00:00:00Z")), map[string][]string{"now": {"2020-01-02T00:00:00Z"}}, true},
+		{mustFunc(NewDateGreaterThanFunc("now", "2020-01-01T00:00:00Z")), map[string][]string{"now": {"yesterday"}}, false},
+		{mustFunc(NewBoolFunc("secure", "true")), map[string][]string{"secure": {"true"}}, true},
+		{mustFunc(NewBoolFunc("secure", "true")), map[string][]string{"secure": {"false"}}, false},
+		{mustFunc(NewIPAddressFunc("ip", "192.168.1.0/24")), map[string][]string{"ip": {"192.168.1.10"}}, true},
+		{mustFunc(NewIPAddressFunc("ip", "192.168.1.0/24")), map[string][]string{"ip": {"10.0.0.1"}}, false},
+	}
+
+	for i, testCase := range testCases {
+		if result := testCase.f.evaluate(testCase.values); result != testCase.expected {
+			t.Errorf("case %v: %v expected: %v, got: %v", i+1, testCase.f, testCase.expected, result)
+		}
+	}
+}
+
+func TestNewFuncErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{"empty key", second(NewStringEqualsFunc("", "a"))},
+		{"no values", second(NewStringEqualsFunc("k"))},
+		{"invalid number", second(NewNumericEqualsFunc("k", "x"))},
+		{"several numbers", second(NewNumericEqualsFunc("k", "1", "2"))},
+		{"invalid date", second(NewDateLessThanFunc("k", "2020-01-01"))},
+		{"invalid bool", second(NewBoolFunc("k", "yes please"))},
+		{"invalid CIDR", second(NewIPAddressFunc("k", "10.0.0.1"))},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.err == nil {
+			t.Errorf("%v: expected an error", testCase.name)
+		}
+	}
+}
+
+func second(_ Function, err error) error {
+	return err
+}
+
+func TestFunctionsJSON(t *testing.T) {
+	data := []byte(`{
+		"StringEquals": {"team": ["dev", "ops"]},
+		"NumericLessThan": {"max-keys": 100},
+		"Bool": {"secure": true},
+		"IpAddress": {"ip": "10.0.0.0/8"}
+	}`)
+
+	var functions Functions
+	if err := json.Unmarshal(data, &functions); err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) != 4 {
+		t.Fatalf("expected 4 functions, got %v", functions)
+	}
+
+	values := map[string][]string{
+		"team":     {"ops"},
+		"max-keys": {"10"},
+		"secure":   {"true"},
+		"ip":       {"10.1.2.3"},
+	}
+	if !functions.Evaluate(values) {
+		t.Error("expected all functions to hold")
+	}
+	values["secure"] = []string{"false"}
+	if functions.Evaluate(values) {
+		t.Error("expected the Bool function not to hold")
+	}
+
+	encoded, err := json.Marshal(functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Functions
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !functions.Equals(decoded) {
+		t.Errorf("round trip mismatch: %s", encoded)
+	}
+
+	if err = json.Unmarshal([]byte(`{"StringSomething": {"k": "v"}}`), &decoded); err == nil {
+		t.Error("expected unknown operator to be rejected")
+	}
+}
@@ -0,0 +1,310 @@
+package condition
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio/pkg/wildcard"
+)
+
+// Condition operator names
+const (
+	StringEquals       = "StringEquals"
+	StringNotEquals    = "StringNotEquals"
+	StringLike         = "StringLike"
+	NumericEquals      = "NumericEquals"
+	NumericLessThan    = "NumericLessThan"
+	NumericGreaterThan = "NumericGreaterThan"
+	DateLessThan       = "DateLessThan"
+	DateGreaterThan    = "DateGreaterThan"
+	Bool               = "Bool"
+	IPAddress          = "IpAddress"
+)
+
+var operators = map[string]func(key string, values ...string) (Function, error){
+	StringEquals:       NewStringEqualsFunc,
+	StringNotEquals:    NewStringNotEqualsFunc,
+	StringLike:         NewStringLikeFunc,
+	NumericEquals:      NewNumericEqualsFunc,
+	NumericLessThan:    NewNumericLessThanFunc,
+	NumericGreaterThan: NewNumericGreaterThanFunc,
+	DateLessThan:       NewDateLessThanFunc,
+	DateGreaterThan:    NewDateGreaterThanFunc,
+	Bool:               NewBoolFunc,
+	IPAddress:          NewIPAddressFunc,
+}
+
+type baseFunc struct {
+	n    string
+	k    string
+	vals []string
+}
+
+func (f baseFunc) name() string {
+	return f.n
+}
+
+func (f baseFunc) key() string {
+	return f.k
+}
+
+func (f baseFunc) values() []string {
+	return f.vals
+}
+
+func (f baseFunc) String() string {
+	return fmt.Sprintf("%v:%v:%v", f.n, f.k, f.vals)
+}
+
+func newBaseFunc(name, key string, values []string) (baseFunc, error) {
+	if key == "" {
+		return baseFunc{}, fmt.Errorf("%v: key must not be empty", name)
+	}
+	if len(values) == 0 {
+		return baseFunc{}, fmt.Errorf("%v: values must not be empty", name)
+	}
+
+	return baseFunc{n: name, k: key, vals: values}, nil
+}
+
+func newSingleValueFunc(name, key string, values []string) (baseFunc, error) {
+	f, err := newBaseFunc(name, key, values)
+	if err == nil && len(values) != 1 {
+		err = fmt.Errorf("%v: only one value is allowed for %v, got %v", name, key, values)
+	}
+
+	return f, err
+}
+
+// stringFunc holds when any request value equals, or matches when like is set,
+// any of the function values. negate inverts the result.
+type stringFunc struct {
+	baseFunc
+	like   bool
+	negate bool
+}
+
+func (f stringFunc) evaluate(values map[string][]string) bool {
+	matched := false
+	for _, v := range values[f.k] {
+		for _, pattern := range f.vals {
+			if (f.like && wildcard.Match(pattern, v)) || (!f.like && pattern == v) {
+				matched = true
+				break
+			}
+		}
+	}
+
+	return matched != f.negate
+}
+
+// NewStringEqualsFunc returns a function holding when the key has one of the
+// given values.
+func NewStringEqualsFunc(key string, values ...string) (Function, error) {
+	f, err := newBaseFunc(StringEquals, key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringFunc{baseFunc: f}, nil
+}
+
+// NewStringNotEqualsFunc returns a function holding when the key has none of
+// the given values, including when it is missing.
+func NewStringNotEqualsFunc(key string, values ...string) (Function, error) {
+	f, err := newBaseFunc(StringNotEquals, key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringFunc{baseFunc: f, negate: true}, nil
+}
+
+// NewStringLikeFunc returns a function holding when the key matches one of the
+// given wildcard patterns.
+func NewStringLikeFunc(key string, values ...string) (Function, error) {
+	f, err := newBaseFunc(StringLike, key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringFunc{baseFunc: f, like: true}, nil
+}
+
+// numericFunc compares the request value with the function value, cmp is
+// negative, zero or positive as the request value is lower, equal or greater.
+type numericFunc struct {
+	baseFunc
+	value float64
+	holds func(cmp int) bool
+}
+
+func (f numericFunc) evaluate(values map[string][]string) bool {
+	for _, v := range values[f.k] {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		cmp := 0
+		if n < f.value {
+			cmp = -1
+		} else if n > f.value {
+			cmp = 1
+		}
+		if f.holds(cmp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newNumericFunc(name, key string, values []string, holds func(cmp int) bool) (Function, error) {
+	f, err := newSingleValueFunc(name, key, values)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseFloat(values[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid number %q for %v", name, values[0], key)
+	}
+
+	return numericFunc{baseFunc: f, value: n, holds: holds}, nil
+}
+
+// NewNumericEqualsFunc returns a function holding when the key equals value.
+func NewNumericEqualsFunc(key string, values ...string) (Function, error) {
+	return newNumericFunc(NumericEquals, key, values, func(cmp int) bool { return cmp == 0 })
+}
+
+// NewNumericLessThanFunc returns a function holding when the key is lower than
+// value.
+func NewNumericLessThanFunc(key string, values ...string) (Function, error) {
+	return newNumericFunc(NumericLessThan, key, values, func(cmp int) bool { return cmp < 0 })
+}
+
+// NewNumericGreaterThanFunc returns a function holding when the key is greater
+// than value.
+func NewNumericGreaterThanFunc(key string, values ...string) (Function, error) {
+	return newNumericFunc(NumericGreaterThan, key, values, func(cmp int) bool { return cmp > 0 })
+}
+
+// dateFunc compares the request time, formatted as RFC3339, with the function
+// time.
+type dateFunc struct {
+	baseFunc
+	t      time.Time
+	before bool
+}
+
+func (f dateFunc) evaluate(values map[string][]string) bool {
+	for _, v := range values[f.k] {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			continue
+		}
+		if (f.before && t.Before(f.t)) || (!f.before && t.After(f.t)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newDateFunc(name, key string, values []string, before bool) (Function, error) {
+	f, err := newSingleValueFunc(name, key, values)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339, values[0])
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid RFC3339 date %q for %v", name, values[0], key)
+	}
+
+	return dateFunc{baseFunc: f, t: t, before: before}, nil
+}
+
+// NewDateLessThanFunc returns a function holding when the key, an RFC3339
+// date, is before the given one.
+func NewDateLessThanFunc(key string, values ...string) (Function, error) {
+	return newDateFunc(DateLessThan, key, values, true)
+}
+
+// NewDateGreaterThanFunc returns a function holding when the key, an RFC3339
+// date, is after the given one.
+func NewDateGreaterThanFunc(key string, values ...string) (Function, error) {
+	return newDateFunc(DateGreaterThan, key, values, false)
+}
+
+type boolFunc struct {
+	baseFunc
+	value bool
+}
+
+func (f boolFunc) evaluate(values map[string][]string) bool {
+	for _, v := range values[f.k] {
+		if b, err := strconv.ParseBool(v); err == nil && b == f.value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewBoolFunc returns a function holding when the key has the given boolean
+// value.
+func NewBoolFunc(key string, values ...string) (Function, error) {
+	f, err := newSingleValueFunc(Bool, key, values)
+	if err != nil {
+		return nil, err
+	}
+	b, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid boolean %q for %v", Bool, values[0], key)
+	}
+
+	return boolFunc{baseFunc: f, value: b}, nil
+}
+
+type ipAddressFunc struct {
+	baseFunc
+	nets []*net.IPNet
+}
+
+func (f ipAddressFunc) evaluate(values map[string][]string) bool {
+	for _, v := range values[f.k] {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			continue
+		}
+		for _, n := range f.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NewIPAddressFunc returns a function holding when the key is an IP address in
+// one of the given CIDR ranges.
+func NewIPAddressFunc(key string, values ...string) (Function, error) {
+	f, err := newBaseFunc(IPAddress, key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid CIDR %q for %v", IPAddress, v, key)
+		}
+		nets = append(nets, n)
+	}
+
+	return ipAddressFunc{baseFunc: f, nets: nets}, nil
+}
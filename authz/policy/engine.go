@@ -1,8 +1,36 @@
 package policy
 
 import (
+	"context"
+
 	"github.com/thatique/awan/auth/user"
 	"github.com/thatique/awan/authz/authorizer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const pkgName = "github.com/thatique/awan/authz/policy"
+
+var (
+	decisionMeasure = stats.Int64(pkgName+"/decisions", "Number of authorization decisions", stats.UnitDimensionless)
+
+	// DecisionKey is the tag key recording the outcome of an authorization,
+	// either "allow" or "deny".
+	DecisionKey = tag.MustNewKey("decision")
+
+	// OpenCensusViews are predefined views for OpenCensus metrics.
+	// The views include counts of authorization decisions by outcome.
+	// See the example at https://godoc.org/go.opencensus.io/stats/view for usage.
+	OpenCensusViews = []*view.View{
+		{
+			Name:        pkgName + "/decisions",
+			Measure:     decisionMeasure,
+			Description: "Count of authorization decisions by outcome.",
+			TagKeys:     []tag.Key{DecisionKey},
+			Aggregation: view.Count(),
+		},
+	}
 )
 
 // NewAuthorizer create new authorizer based on policy
@@ -20,6 +48,8 @@ type engine struct {
 }
 
 func (e *engine) Authorize(args authorizer.Args) (authorized authorizer.Decision, err error) {
+	defer func() { recordDecision(authorized) }()
+
 	policies, err := e.lister.GetPoliciesForUser(args.User)
 	if err != nil {
 		return authorizer.DecisionDeny, err
@@ -38,3 +68,12 @@ func (e *engine) Authorize(args authorizer.Args) (authorized authorizer.Decision
 
 	return authorizer.DecisionDeny, nil
 }
+
+func recordDecision(decision authorizer.Decision) {
+	value := "deny"
+	if decision == authorizer.DecisionAllow {
+		value = "allow"
+	}
+	stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(DecisionKey, value)}, decisionMeasure.M(1))
+}
@@ -0,0 +1,51 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/thatique/awan/auth/user"
+	"github.com/thatique/awan/authz/authorizer"
+	"go.opencensus.io/stats/view"
+)
+
+type staticLister []Policy
+
+func (l staticLister) GetPoliciesForUser(user user.Info) ([]Policy, error) {
+	return l, nil
+}
+
+func TestAuthorizeRecordsDecisions(t *testing.T) {
+	if err := view.Register(OpenCensusViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(OpenCensusViews...)
+
+	a := NewAuthorizer(staticLister{testPolicy()})
+	u := &user.DefaultInfo{Name: "foo"}
+
+	for _, args := range []authorizer.Args{
+		{User: u, Action: "GetObject", Resource: "mybucket/foo"},
+		{User: u, Action: "GetObject", Resource: "mybucket/bar"},
+		{User: u, Action: "PutObject", Resource: "mybucket/readonly/foo"},
+	} {
+		if _, err := a.Authorize(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := view.RetrieveData(pkgName + "/decisions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, row := range rows {
+		for _, tg := range row.Tags {
+			if tg.Key == DecisionKey {
+				got[tg.Value] = row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if got["allow"] != 2 || got["deny"] != 1 {
+		t.Errorf("expected 2 allow and 1 deny decisions, got: %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type matchKind int
+
+const (
+	matchExact  matchKind = iota // no wildcard
+	matchAny                     // "*"
+	matchPrefix                  // a single trailing "*"
+	matchGlob                    // anything else
+)
+
+// matcher is a compiled wildcard pattern. It matches like wildcard.Match: '*'
+// matches any sequence of characters and '?' exactly one. Neither compiling
+// nor matching allocates, so patterns are compiled when matched.
+type matcher struct {
+	pattern string
+	kind    matchKind
+	// fold makes the match case insensitive
+	fold bool
+}
+
+func compileMatcher(pattern string, fold bool) matcher {
+	m := matcher{pattern: pattern, fold: fold}
+
+	switch i := strings.IndexAny(pattern, "*?"); {
+	case i < 0:
+		m.kind = matchExact
+	case pattern == "*":
+		m.kind = matchAny
+	case i == len(pattern)-1 && pattern[i] == '*':
+		m.kind = matchPrefix
+		m.pattern = pattern[:i]
+	default:
+		m.kind = matchGlob
+	}
+
+	return m
+}
+
+func (m matcher) match(name string) bool {
+	switch m.kind {
+	case matchAny:
+		return true
+	case matchExact:
+		return m.matchLiteral(name) == len(name)
+	case matchPrefix:
+		return m.matchLiteral(name) >= 0
+	}
+
+	return m.matchGlob(name)
+}
+
+// matchLiteral returns the length of the prefix of name matching the whole
+// pattern, taken literally, or -1 if name doesn't start with it
+func (m matcher) matchLiteral(name string) int {
+	if !m.fold {
+		if strings.HasPrefix(name, m.pattern) {
+			return len(m.pattern)
+		}
+		return -1
+	}
+
+	n := 0
+	for _, pr := range m.pattern {
+		if n >= len(name) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(name[n:])
+		if unicode.ToLower(r) != unicode.ToLower(pr) {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// matchGlob matches name against the pattern, backtracking to the last '*'
+// on a mismatch
+func (m matcher) matchGlob(name string) bool {
+	p, n := 0, 0
+	starP, starN := -1, -1
+	for n < len(name) {
+		if p < len(m.pattern) {
+			pr, psize := utf8.DecodeRuneInString(m.pattern[p:])
+			nr, nsize := utf8.DecodeRuneInString(name[n:])
+			if m.fold {
+				pr, nr = unicode.ToLower(pr), unicode.ToLower(nr)
+			}
+			switch {
+			case pr == '*':
+				starP, starN = p, n
+				p += psize
+				continue
+			case pr == '?' || pr == nr:
+				p += psize
+				n += nsize
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// let the last '*' swallow one more character
+		_, nsize := utf8.DecodeRuneInString(name[starN:])
+		starN += nsize
+		p, n = starP+1, starN
+	}
+
+	for p < len(m.pattern) && m.pattern[p] == '*' {
+		p++
+	}
+	return p == len(m.pattern)
+}
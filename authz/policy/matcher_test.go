@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/minio/minio/pkg/wildcard"
+)
+
+func TestMatcherMatchesLikeWildcard(t *testing.T) {
+	patterns := []string{
+		"", "*", "**", "?", "mybucket", "mybucket/*", "mybucket/*/key", "*.txt", "my?ucket/*",
+		"*bucket*", "a*b*c", "a*b?c*", "ü*ß", "??", "mybucket/?*",
+	}
+	names := []string{
+		"", "m", "mybucket", "mybucket/", "mybucket/key", "mybucket/a/key", "mybucket/a/b/key", "notes.txt",
+		".txt", "myxucket/k", "xbucketx", "abc", "aXbYc", "abbc", "ab?c", "üxyß", "üß", "ab", "abc/def",
+	}
+
+	for _, pattern := range patterns {
+		m := compileMatcher(pattern, false)
+		for _, name := range names {
+			if got, want := m.match(name), wildcard.Match(pattern, name); got != want {
+				t.Errorf("match(%q, %q) = %v, wildcard.Match = %v", pattern, name, got, want)
+			}
+		}
+	}
+}
+
+func TestMatcherFold(t *testing.T) {
+	for _, pattern := range []string{"GetObject", "Get*", "get?bject", "*OBJECT"} {
+		m := compileMatcher(pattern, true)
+		for _, name := range []string{"GetObject", "getobject", "GETOBJECT"} {
+			if !m.match(name) {
+				t.Errorf("expected %q to match %q", pattern, name)
+			}
+			if got, want := m.match(name+"x"), wildcard.Match(strings.ToLower(pattern), strings.ToLower(name+"x")); got != want {
+				t.Errorf("match(%q, %q) = %v, want %v", pattern, name+"x", got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"reflect"
+
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+// Merge concatenates the statements of the given policies into a single
+// policy. Since any matching Deny statement wins, an explicit deny in one
+// policy still overrides an allow in another. Statements repeated verbatim
+// across policies are only kept once. The merged policy is validated.
+func Merge(policies ...Policy) (Policy, error) {
+	var merged Policy
+	for _, policy := range policies {
+		for _, statement := range policy.Statements {
+			if !containsStatement(merged.Statements, statement) {
+				merged.Statements = append(merged.Statements, statement)
+			}
+		}
+	}
+
+	return merged, merged.IsValid()
+}
+
+func containsStatement(statements []Statement, statement Statement) bool {
+	for _, s := range statements {
+		if reflect.DeepEqual(s, statement) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MergedPolicySet evaluates several policies as if they were merged, without
+// flattening them first: a Deny statement of any policy overrides the Allow
+// statements of all the others.
+type MergedPolicySet []Policy
+
+// Evaluate the policies for the given args like Policy.Evaluate.
+func (set MergedPolicySet) Evaluate(args authorizer.Args) (allowed bool, decidingStatement *Statement, reason string) {
+	statementSets := make([][]Statement, len(set))
+	for i, policy := range set {
+		statementSets[i] = policy.Statements
+	}
+
+	return evaluate(args, statementSets...)
+}
+
+// IsAllowed evaluate the policies for the give args
+func (set MergedPolicySet) IsAllowed(args authorizer.Args) bool {
+	allowed, _, _ := set.Evaluate(args)
+	return allowed
+}
+
+// IsValid check if every policy is valid
+func (set MergedPolicySet) IsValid() error {
+	for _, policy := range set {
+		if err := policy.IsValid(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
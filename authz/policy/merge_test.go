@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+func TestMergeDenyWins(t *testing.T) {
+	readWrite := Policy{ID: "rw", Statements: []Statement{
+		NewStatement(Allow, NewActionSet("GetObject", "PutObject"), NewResourceSet("mybucket/*")),
+	}}
+	readOnly := Policy{ID: "ro", Statements: []Statement{
+		NewStatement(Deny, NewActionSet("PutObject"), NewResourceSet("mybucket/*")),
+		// repeated verbatim from readWrite
+		NewStatement(Allow, NewActionSet("GetObject", "PutObject"), NewResourceSet("mybucket/*")),
+	}}
+
+	merged, err := Merge(readWrite, readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Statements) != 2 {
+		t.Errorf("expected duplicated statement to be dropped, got %d statements", len(merged.Statements))
+	}
+	set := MergedPolicySet{readWrite, readOnly}
+
+	testCases := []struct {
+		args     authorizer.Args
+		expected bool
+	}{
+		{authorizer.Args{Action: "GetObject", Resource: "mybucket/foo"}, true},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/foo"}, false},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/foo", IsOwner: true}, false},
+		{authorizer.Args{Action: "DeleteObject", Resource: "mybucket/foo"}, false},
+	}
+	for i, testCase := range testCases {
+		if result := merged.IsAllowed(testCase.args); result != testCase.expected {
+			t.Errorf("case %v: Merge expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+		if result := set.IsAllowed(testCase.args); result != testCase.expected {
+			t.Errorf("case %v: MergedPolicySet expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+	}
+
+	_, statement, reason := set.Evaluate(authorizer.Args{Action: "PutObject", Resource: "mybucket/foo"})
+	if reason != ReasonExplicitDeny || statement == nil || statement.Effect != Deny {
+		t.Errorf("expected the deny statement to decide, got %v (%v)", statement, reason)
+	}
+}
+
+func TestMergeValidates(t *testing.T) {
+	a := Policy{Statements: []Statement{
+		NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*")),
+	}}
+	b := Policy{Statements: []Statement{
+		NewStatement(Allow, NewActionSet("GetObject", "PutObject"), NewResourceSet("mybucket/*")),
+	}}
+	if _, err := Merge(a, b); err == nil {
+		t.Error("expected overlapping allow statements to fail validation")
+	}
+	if err := (MergedPolicySet{a, b}).IsValid(); err != nil {
+		t.Errorf("expected each policy to be valid on its own, got %v", err)
+	}
+}
@@ -16,32 +16,56 @@ type Policy struct {
 	Statements []Statement `json:"Statements"`
 }
 
-// IsAllowed evaluate policy statement for the give args
-func (policy Policy) IsAllowed(args authorizer.Args) bool {
-	// Check all deny statements. If any one statement denies, return false.
-	for _, statement := range policy.Statements {
-		if statement.Effect == Deny {
-			if !statement.IsAllowed(args) {
-				return false
+// Reasons of a policy decision
+const (
+	// ReasonExplicitDeny a Deny statement matched the request
+	ReasonExplicitDeny = "explicit deny"
+	// ReasonOwner the request was allowed because it's made by the owner
+	ReasonOwner = "owner"
+	// ReasonAllow an Allow statement matched the request
+	ReasonAllow = "allow"
+	// ReasonImplicitDeny no statement allowed the request
+	ReasonImplicitDeny = "implicit deny"
+)
+
+// Evaluate the policy for the given args, reporting the statement deciding the
+// outcome and the reason of the decision. Any matching Deny statement wins,
+// then owners are allowed, then the first matching Allow statement allows.
+// decidingStatement is nil for the owner override and when nothing matched.
+func (policy Policy) Evaluate(args authorizer.Args) (allowed bool, decidingStatement *Statement, reason string) {
+	return evaluate(args, policy.Statements)
+}
+
+// evaluate the statements of one or more policies as if they were a single
+// policy.
+func evaluate(args authorizer.Args, statementSets ...[]Statement) (bool, *Statement, string) {
+	for _, statements := range statementSets {
+		for i, statement := range statements {
+			if statement.Effect == Deny && !statement.IsAllowed(args) {
+				return false, &statements[i], ReasonExplicitDeny
 			}
 		}
 	}
 
-	// For owner, its allowed by default.
 	if args.IsOwner {
-		return true
+		return true, nil, ReasonOwner
 	}
 
-	// Check all allow statements. If any one statement allows, return true.
-	for _, statement := range policy.Statements {
-		if statement.Effect == Allow {
-			if statement.IsAllowed(args) {
-				return true
+	for _, statements := range statementSets {
+		for i, statement := range statements {
+			if statement.Effect == Allow && statement.IsAllowed(args) {
+				return true, &statements[i], ReasonAllow
 			}
 		}
 	}
 
-	return false
+	return false, nil, ReasonImplicitDeny
+}
+
+// IsAllowed evaluate policy statement for the give args
+func (policy Policy) IsAllowed(args authorizer.Args) bool {
+	allowed, _, _ := policy.Evaluate(args)
+	return allowed
 }
 
 // IsValid check if the policy is valid
@@ -54,7 +78,20 @@ func (policy Policy) IsValid() error {
 
 	for i := range policy.Statements {
 		for _, statement := range policy.Statements[i+1:] {
+			// an Allow and a Deny on the same actions aren't duplicates,
+			// the Deny simply wins, nor are statements for other principals
+			if policy.Statements[i].Effect != statement.Effect ||
+				!policy.Statements[i].Principals.Equals(statement.Principals) ||
+				!policy.Statements[i].NotPrincipals.Equals(statement.NotPrincipals) ||
+				!policy.Statements[i].NotActions.Equals(statement.NotActions) {
+				continue
+			}
+
 			actions := policy.Statements[i].Actions.Intersection(statement.Actions)
+			if len(statement.NotActions) > 0 {
+				// neither has Actions, both apply to every action but these
+				actions = statement.NotActions
+			}
 			if len(actions) == 0 {
 				continue
 			}
@@ -64,6 +101,10 @@ func (policy Policy) IsValid() error {
 				continue
 			}
 
+			if !policy.Statements[i].Conditions.Equals(statement.Conditions) {
+				continue
+			}
+
 			return fmt.Errorf("duplicate actions %v, resources %v found in statements %v, %v",
 				actions, resources, policy.Statements[i], statement)
 		}
@@ -0,0 +1,324 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/thatique/awan/auth/user"
+	"github.com/thatique/awan/authz/authorizer"
+	"github.com/thatique/awan/authz/policy/condition"
+)
+
+func testPolicy() Policy {
+	return Policy{
+		ID: "test",
+		Statements: []Statement{
+			NewStatement(Allow, NewActionSet("GetObject", "PutObject"), NewResourceSet("mybucket/*")),
+			NewStatement(Deny, NewActionSet("PutObject"), NewResourceSet("mybucket/readonly/*")),
+			NewStatement(Allow, NewActionSet("ListBucket"), NewResourceSet("mybucket")),
+		},
+	}
+}
+
+func TestPolicyIsAllowed(t *testing.T) {
+	p := testPolicy()
+
+	testCases := []struct {
+		args     authorizer.Args
+		expected bool
+	}{
+		{authorizer.Args{Action: "GetObject", Resource: "mybucket/foo"}, true},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/foo"}, true},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/readonly/foo"}, false},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/readonly/foo", IsOwner: true}, false},
+		{authorizer.Args{Action: "DeleteObject", Resource: "mybucket/foo"}, false},
+		{authorizer.Args{Action: "DeleteObject", Resource: "mybucket/foo", IsOwner: true}, true},
+		{authorizer.Args{Action: "ListBucket", Resource: "mybucket"}, true},
+		{authorizer.Args{Action: "ListBucket", Resource: "otherbucket"}, false},
+	}
+
+	for i, testCase := range testCases {
+		if result := p.IsAllowed(testCase.args); result != testCase.expected {
+			t.Errorf("case %v: Policy.IsAllowed expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+	}
+}
+
+func largePolicy(n int) Policy {
+	p := Policy{ID: "large"}
+	for i := 0; i < n; i++ {
+		effect := Allow
+		if i%2 == 0 {
+			effect = Deny
+		}
+		p.Statements = append(p.Statements, NewStatement(effect,
+			NewActionSet(authorizer.Action(fmt.Sprintf("Action%d", i))),
+			NewResourceSet(fmt.Sprintf("bucket%d/*", i))))
+	}
+	return p
+}
+
+func BenchmarkPolicyIsAllowed(b *testing.B) {
+	p := largePolicy(100)
+	args := authorizer.Args{Action: "Action99", Resource: "bucket99/key"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.IsAllowed(args)
+	}
+}
+
+func TestStatementConditions(t *testing.T) {
+	data := []byte(`{
+		"ID": "conditional",
+		"Statements": [{
+			"SID": "OfficeOnly",
+			"Effect": "Allow",
+			"Action": ["GetObject"],
+			"Resource": ["mybucket/*"],
+			"Condition": {
+				"IpAddress": {"SourceIp": "192.168.0.0/16"},
+				"StringLike": {"UserAgent": "awan/*"}
+			}
+		}]
+	}`)
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		metadata map[string]string
+		expected bool
+	}{
+		{map[string]string{"SourceIp": "192.168.1.1", "UserAgent": "awan/1.0"}, true},
+		{map[string]string{"SourceIp": "10.0.0.1", "UserAgent": "awan/1.0"}, false},
+		{map[string]string{"SourceIp": "192.168.1.1", "UserAgent": "curl/7.0"}, false},
+		{nil, false},
+	}
+	for i, testCase := range testCases {
+		args := authorizer.Args{Action: "GetObject", Resource: "mybucket/foo", Metadata: testCase.metadata}
+		if result := p.IsAllowed(args); result != testCase.expected {
+			t.Errorf("case %v: expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+	}
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Policy
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Statements[0].Conditions.Equals(p.Statements[0].Conditions) {
+		t.Errorf("conditions not round-tripped: %s", encoded)
+	}
+}
+
+func TestStatementCurrentTime(t *testing.T) {
+	data := []byte(`{
+		"ID": "temporary",
+		"Statements": [{
+			"SID": "UntilExpiry",
+			"Effect": "Allow",
+			"Action": ["GetObject"],
+			"Resource": ["mybucket/*"],
+			"Condition": {
+				"DateLessThan": {"aws:CurrentTime": "2030-01-01T00:00:00Z"}
+			}
+		}]
+	}`)
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { timeNow = time.Now }()
+
+	testCases := []struct {
+		now      string
+		metadata map[string]string
+		expected bool
+	}{
+		{"2029-12-31T23:59:59Z", nil, true},
+		{"2030-01-01T00:00:00Z", nil, false},
+		{"2031-06-01T00:00:00Z", nil, false},
+		// the request can't pin the time to extend the grant
+		{"2031-06-01T00:00:00Z", map[string]string{condition.CurrentTime: "2029-12-31T23:59:59Z"}, false},
+	}
+	for i, testCase := range testCases {
+		now, err := time.Parse(time.RFC3339, testCase.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timeNow = func() time.Time { return now }
+
+		args := authorizer.Args{Action: "GetObject", Resource: "mybucket/foo", Metadata: testCase.metadata}
+		if result := p.IsAllowed(args); result != testCase.expected {
+			t.Errorf("case %v: expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+	}
+	timeNow = time.Now
+
+	expired := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	f, err := condition.NewDateLessThanFunc(condition.CurrentTime, time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Conditions = condition.NewFunctions(f)
+	if (Policy{Statements: []Statement{expired}}).IsAllowed(authorizer.Args{Action: "GetObject", Resource: "mybucket/foo"}) {
+		t.Error("expected an expired grant to deny the request")
+	}
+}
+
+func TestNotPrincipalAndNotAction(t *testing.T) {
+	data := []byte(`{
+		"ID": "negation",
+		"Statements": [
+			{"SID": "AllowAll", "Effect": "Allow", "Action": ["*"], "Resource": ["mybucket/*"]},
+			{"SID": "OnlyAliceWrites", "Effect": "Deny", "NotPrincipal": ["alice"], "Action": ["PutObject"], "Resource": ["mybucket/*"]},
+			{"SID": "ArchiveReadOnly", "Effect": "Deny", "NotAction": ["GetObject"], "Resource": ["mybucket/archive/*"]}
+		]
+	}`)
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	bob := &user.DefaultInfo{Name: "bob", Groups: []string{"staff"}}
+	testCases := []struct {
+		args     authorizer.Args
+		expected bool
+	}{
+		{authorizer.Args{User: alice, Action: "PutObject", Resource: "mybucket/foo"}, true},
+		{authorizer.Args{User: bob, Action: "PutObject", Resource: "mybucket/foo"}, false},
+		{authorizer.Args{User: bob, Action: "GetObject", Resource: "mybucket/foo"}, true},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/foo"}, false},
+		{authorizer.Args{User: alice, Action: "GetObject", Resource: "mybucket/archive/foo"}, true},
+		{authorizer.Args{User: alice, Action: "DeleteObject", Resource: "mybucket/archive/foo"}, false},
+	}
+	for i, testCase := range testCases {
+		if result := p.IsAllowed(testCase.args); result != testCase.expected {
+			t.Errorf("case %v: expected: %v, got: %v", i+1, testCase.expected, result)
+		}
+	}
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Policy
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("round trip failed: %v\n%s", err, encoded)
+	}
+	if len(decoded.Statements[1].NotPrincipals) != 1 || len(decoded.Statements[2].NotActions) != 1 {
+		t.Errorf("negated fields not round-tripped: %s", encoded)
+	}
+}
+
+func TestPrincipalGroups(t *testing.T) {
+	statement := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	statement.Principals = NewPrincipalSet(GroupPrefix + "staff")
+
+	args := authorizer.Args{Action: "GetObject", Resource: "mybucket/foo"}
+	args.User = &user.DefaultInfo{Name: "bob", Groups: []string{"staff"}}
+	if !statement.IsAllowed(args) {
+		t.Error("expected staff member to be allowed")
+	}
+	args.User = &user.DefaultInfo{Name: "carol", Groups: []string{"guests"}}
+	if statement.IsAllowed(args) {
+		t.Error("expected non staff member not to be allowed")
+	}
+}
+
+func TestStatementIsValidNegation(t *testing.T) {
+	both := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	both.NotActions = NewActionSet("PutObject")
+	if err := both.IsValid(); err == nil {
+		t.Error("expected Action and NotAction together to be rejected")
+	}
+
+	principals := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	principals.Principals = NewPrincipalSet("alice")
+	principals.NotPrincipals = NewPrincipalSet("bob")
+	if err := principals.IsValid(); err == nil {
+		t.Error("expected Principal and NotPrincipal together to be rejected")
+	}
+
+	var s Statement
+	if err := json.Unmarshal([]byte(`{"Effect": "Allow", "Action": ["A"], "NotAction": ["B"], "Resource": ["r"]}`), &s); err == nil {
+		t.Error("expected unmarshaling Action and NotAction together to fail")
+	}
+}
+
+func TestPolicyIsValidDuplicates(t *testing.T) {
+	alice := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	alice.Principals = NewPrincipalSet("alice")
+	bob := NewStatement(Allow, NewActionSet("GetObject"), NewResourceSet("mybucket/*"))
+	bob.Principals = NewPrincipalSet("bob")
+	if err := (Policy{Statements: []Statement{alice, bob}}).IsValid(); err != nil {
+		t.Errorf("expected statements for different principals to be valid, got %v", err)
+	}
+
+	notAlice := NewStatement(Deny, NewActionSet("PutObject"), NewResourceSet("mybucket/*"))
+	notAlice.NotPrincipals = NewPrincipalSet("alice")
+	notBob := NewStatement(Deny, NewActionSet("PutObject"), NewResourceSet("mybucket/*"))
+	notBob.NotPrincipals = NewPrincipalSet("bob")
+	if err := (Policy{Statements: []Statement{notAlice, notBob}}).IsValid(); err != nil {
+		t.Errorf("expected statements excluding different principals to be valid, got %v", err)
+	}
+
+	exceptGet := NewStatement(Deny, NewActionSet(), NewResourceSet("mybucket/*"))
+	exceptGet.NotActions = NewActionSet("GetObject")
+	exceptList := NewStatement(Deny, NewActionSet(), NewResourceSet("mybucket/*"))
+	exceptList.NotActions = NewActionSet("ListBucket")
+	if err := (Policy{Statements: []Statement{exceptGet, exceptList}}).IsValid(); err != nil {
+		t.Errorf("expected statements excluding different actions to be valid, got %v", err)
+	}
+	if err := (Policy{Statements: []Statement{exceptGet, exceptGet}}).IsValid(); err == nil {
+		t.Error("expected identical NotAction statements to be duplicates")
+	}
+	if err := (Policy{Statements: []Statement{alice, alice}}).IsValid(); err == nil {
+		t.Error("expected identical statements to be duplicates")
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := testPolicy()
+	p.Statements[0].SID = "AllowObjects"
+	p.Statements[1].SID = "DenyReadonlyWrites"
+	p.Statements[2].SID = "AllowList"
+
+	testCases := []struct {
+		args    authorizer.Args
+		allowed bool
+		sid     string
+		reason  string
+	}{
+		{authorizer.Args{Action: "GetObject", Resource: "mybucket/foo"}, true, "AllowObjects", ReasonAllow},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/readonly/foo"}, false, "DenyReadonlyWrites", ReasonExplicitDeny},
+		{authorizer.Args{Action: "PutObject", Resource: "mybucket/readonly/foo", IsOwner: true}, false, "DenyReadonlyWrites", ReasonExplicitDeny},
+		{authorizer.Args{Action: "DeleteObject", Resource: "mybucket/foo", IsOwner: true}, true, "", ReasonOwner},
+		{authorizer.Args{Action: "DeleteObject", Resource: "mybucket/foo"}, false, "", ReasonImplicitDeny},
+		{authorizer.Args{Action: "ListBucket", Resource: "mybucket"}, true, "AllowList", ReasonAllow},
+	}
+
+	for i, testCase := range testCases {
+		allowed, statement, reason := p.Evaluate(testCase.args)
+		sid := ""
+		if statement != nil {
+			sid = statement.SID
+		}
+		if allowed != testCase.allowed || sid != testCase.sid || reason != testCase.reason {
+			t.Errorf("case %v: expected (%v, %q, %q), got (%v, %q, %q)", i+1,
+				testCase.allowed, testCase.sid, testCase.reason, allowed, sid, reason)
+		}
+	}
+}
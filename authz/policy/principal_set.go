@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/minio/minio-go/pkg/set"
+	"github.com/thatique/awan/auth/user"
+)
+
+// GroupPrefix prefixes the principals naming a group instead of a user, e.g.
+// "group:admins"
+const GroupPrefix = "group:"
+
+// PrincipalSet set of principals in policy statement. A principal is a
+// username, or a group name prefixed by GroupPrefix, and may use wildcards.
+type PrincipalSet map[string]struct{}
+
+// Add a principal to PrincipalSet
+func (principalSet PrincipalSet) Add(principal string) {
+	principalSet[principal] = struct{}{}
+}
+
+// Match - returns true if the user, or one of its groups, matches any
+// principal pattern in the set.
+func (principalSet PrincipalSet) Match(u user.Info) bool {
+	var (
+		name   string
+		groups []string
+	)
+	if u != nil {
+		name = u.GetUsername()
+		groups = u.GetGroups()
+	}
+
+	for p := range principalSet {
+		m := compileMatcher(p, false)
+		if m.match(name) {
+			return true
+		}
+		for _, group := range groups {
+			if m.match(GroupPrefix + group) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Equals - returns true if both PrincipalSet hold the same principals
+func (principalSet PrincipalSet) Equals(sset PrincipalSet) bool {
+	if len(principalSet) != len(sset) {
+		return false
+	}
+	for k := range principalSet {
+		if _, ok := sset[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (principalSet PrincipalSet) String() string {
+	principals := []string{}
+	for principal := range principalSet {
+		principals = append(principals, principal)
+	}
+	sort.Strings(principals)
+
+	return fmt.Sprintf("%v", principals)
+}
+
+// MarshalJSON - encodes PrincipalSet to JSON data.
+func (principalSet PrincipalSet) MarshalJSON() ([]byte, error) {
+	if len(principalSet) == 0 {
+		return nil, errors.New("empty principal set")
+	}
+
+	principals := []string{}
+	for principal := range principalSet {
+		principals = append(principals, principal)
+	}
+	sort.Strings(principals)
+
+	return json.Marshal(principals)
+}
+
+// UnmarshalJSON - decodes JSON data to PrincipalSet.
+func (principalSet *PrincipalSet) UnmarshalJSON(data []byte) error {
+	var sset set.StringSet
+	if err := json.Unmarshal(data, &sset); err != nil {
+		return err
+	}
+
+	if len(sset) == 0 {
+		return errors.New("empty principal set")
+	}
+
+	*principalSet = make(PrincipalSet)
+	for _, s := range sset.ToSlice() {
+		principalSet.Add(s)
+	}
+
+	return nil
+}
+
+// NewPrincipalSet - creates new principal set.
+func NewPrincipalSet(principals ...string) PrincipalSet {
+	principalSet := make(PrincipalSet)
+	for _, principal := range principals {
+		principalSet.Add(principal)
+	}
+
+	return principalSet
+}
@@ -5,12 +5,91 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/minio/minio-go/pkg/set"
-	"github.com/minio/minio/pkg/wildcard"
 )
 
-// ResourceSet set of resources in policy statement.
+// Resources are written either as ARNs,
+// "arn:partition:service:region:account:name", or in the "bucket/key"
+// shorthand standing for DefaultPartition and BucketService with no region
+// nor account.
+const (
+	ARNPrefix        = "arn:"
+	DefaultPartition = "awan"
+	BucketService    = "blob"
+)
+
+// Resource is a parsed resource, see ParseResource
+type Resource struct {
+	Partition string
+	Service   string
+	Region    string
+	Account   string
+	// Name is the resource's name, e.g. "bucket/key", it may hold wildcards
+	Name string
+}
+
+// ParseResource parses a resource written as an ARN or in the "bucket/key"
+// shorthand
+func ParseResource(s string) (Resource, error) {
+	if !strings.HasPrefix(s, ARNPrefix) {
+		if s == "" {
+			return Resource{}, errors.New("empty resource")
+		}
+		return Resource{Partition: DefaultPartition, Service: BucketService, Name: s}, nil
+	}
+
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 {
+		return Resource{}, fmt.Errorf("invalid resource ARN %q", s)
+	}
+	r := Resource{Partition: parts[1], Service: parts[2], Region: parts[3], Account: parts[4], Name: parts[5]}
+	if r.Partition == "" || r.Service == "" || r.Name == "" {
+		return Resource{}, fmt.Errorf("invalid resource ARN %q: partition, service and name are required", s)
+	}
+
+	return r, nil
+}
+
+// IsBucketResource returns true if the resource can be written in the
+// "bucket/key" shorthand
+func (r Resource) IsBucketResource() bool {
+	return r.Partition == DefaultPartition && r.Service == BucketService && r.Region == "" && r.Account == ""
+}
+
+// ARN returns the resource in its ARN form
+func (r Resource) ARN() string {
+	return ARNPrefix + strings.Join([]string{r.Partition, r.Service, r.Region, r.Account, r.Name}, ":")
+}
+
+// String returns the resource in the "bucket/key" shorthand if possible,
+// otherwise as an ARN
+func (r Resource) String() string {
+	if r.IsBucketResource() {
+		return r.Name
+	}
+	return r.ARN()
+}
+
+// Match returns true if the resource, used as pattern, matches the given one.
+// Only the name may hold wildcards. Compiling the name doesn't allocate, so
+// there is nothing worth caching between calls.
+func (r Resource) Match(resource Resource) bool {
+	return r.sameNamespace(resource) && compileMatcher(r.Name, false).match(resource.Name)
+}
+
+func (r Resource) sameNamespace(resource Resource) bool {
+	return r.Partition == resource.Partition &&
+		r.Service == resource.Service &&
+		r.Region == resource.Region &&
+		r.Account == resource.Account
+}
+
+// ResourceSet set of resources in policy statement. Resources are kept as
+// written. A pattern in the shorthand form matches the resource as written,
+// like it always did, and also the name of a bucket resource written as an
+// ARN.
 type ResourceSet map[string]struct{}
 
 // Add a resource to ResourceSet
@@ -20,8 +99,24 @@ func (resourceSet ResourceSet) Add(resource string) {
 
 // Match - matches object name with anyone of action pattern in action set.
 func (resourceSet ResourceSet) Match(resource string) bool {
+	res, err := ParseResource(resource)
 	for r := range resourceSet {
-		if wildcard.Match(string(r), string(resource)) {
+		if !strings.HasPrefix(r, ARNPrefix) {
+			m := compileMatcher(r, false)
+			if m.match(resource) || (err == nil && res.IsBucketResource() && m.match(res.Name)) {
+				return true
+			}
+			continue
+		}
+
+		pattern, perr := ParseResource(r)
+		if err != nil || perr != nil {
+			if compileMatcher(r, false).match(resource) {
+				return true
+			}
+			continue
+		}
+		if pattern.Match(res) {
 			return true
 		}
 	}
@@ -74,6 +169,9 @@ func (resourceSet *ResourceSet) UnmarshalJSON(data []byte) error {
 
 	*resourceSet = make(ResourceSet)
 	for _, s := range sset.ToSlice() {
+		if _, err := ParseResource(s); err != nil {
+			return err
+		}
 		resourceSet.Add(s)
 	}
 
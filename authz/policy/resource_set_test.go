@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+func TestParseResource(t *testing.T) {
+	testCases := []struct {
+		resource string
+		expected Resource
+		str      string
+	}{
+		{"mybucket/*", Resource{Partition: DefaultPartition, Service: BucketService, Name: "mybucket/*"}, "mybucket/*"},
+		{"arn:awan:blob:::mybucket/key", Resource{Partition: DefaultPartition, Service: BucketService, Name: "mybucket/key"}, "mybucket/key"},
+		{"arn:awan:queue:::jobs", Resource{Partition: DefaultPartition, Service: "queue", Name: "jobs"}, "arn:awan:queue:::jobs"},
+		{"arn:aws:s3:us-east-1:123:bucket/a:b", Resource{"aws", "s3", "us-east-1", "123", "bucket/a:b"}, "arn:aws:s3:us-east-1:123:bucket/a:b"},
+	}
+
+	for i, testCase := range testCases {
+		r, err := ParseResource(testCase.resource)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if r != testCase.expected {
+			t.Errorf("case %d: expected %+v, got %+v", i+1, testCase.expected, r)
+		}
+		if r.String() != testCase.str {
+			t.Errorf("case %d: expected %q, got %q", i+1, testCase.str, r.String())
+		}
+	}
+
+	for _, invalid := range []string{"", "arn:awan:blob", "arn::blob:::bucket", "arn:awan::::bucket", "arn:awan:blob:::"} {
+		if _, err := ParseResource(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestResourceSetMatchARN(t *testing.T) {
+	resourceSet := NewResourceSet("mybucket/public/*", "arn:awan:blob:::otherbucket/*", "arn:awan:queue:::jobs*")
+
+	testCases := []struct {
+		resource string
+		expected bool
+	}{
+		{"mybucket/public/foo", true},
+		{"arn:awan:blob:::mybucket/public/foo", true},
+		{"mybucket/private/foo", false},
+		{"otherbucket/foo", true},
+		{"arn:awan:blob:::otherbucket/foo", true},
+		{"arn:awan:queue:::jobs-high", true},
+		// same name, other service
+		{"jobs-high", false},
+		{"arn:awan:queue:::mybucket/public/foo", false},
+	}
+
+	for i, testCase := range testCases {
+		if got := resourceSet.Match(testCase.resource); got != testCase.expected {
+			t.Errorf("case %d: Match(%q) expected %v, got %v", i+1, testCase.resource, testCase.expected, got)
+		}
+	}
+}
+
+func TestResourceSetJSONRoundTrip(t *testing.T) {
+	for _, data := range []string{
+		`["mybucket/*"]`,
+		`["arn:awan:blob:::mybucket/*"]`,
+		`["arn:awan:queue:::jobs"]`,
+	} {
+		var resourceSet ResourceSet
+		if err := json.Unmarshal([]byte(data), &resourceSet); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		out, err := json.Marshal(resourceSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != data {
+			t.Errorf("expected %s, got %s", data, out)
+		}
+	}
+
+	var resourceSet ResourceSet
+	if err := json.Unmarshal([]byte(`["arn:awan:blob"]`), &resourceSet); err == nil {
+		t.Error("expected an error for a malformed ARN")
+	}
+}
+
+func TestResourceSetShorthandMatchesRaw(t *testing.T) {
+	resourceSet := NewResourceSet("*")
+	for _, resource := range []string{"mybucket/key", "arn:awan:blob:::mybucket/key", "arn:aws:s3:::x", "arn:awan:queue:::jobs"} {
+		if !resourceSet.Match(resource) {
+			t.Errorf("expected %q to match %q", "*", resource)
+		}
+	}
+
+	p := Policy{Statements: []Statement{
+		NewStatement(Allow, NewActionSet("*"), NewResourceSet("arn:aws:s3:::*")),
+		NewStatement(Deny, NewActionSet("*"), NewResourceSet("*")),
+	}}
+	if p.IsAllowed(authorizer.Args{Action: "GetObject", Resource: "arn:aws:s3:::x"}) {
+		t.Error(`expected Deny "*" to deny resources of every namespace`)
+	}
+}
@@ -0,0 +1,36 @@
+package policy
+
+import (
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+// SimulationResult is the decision of a policy for one simulated request
+type SimulationResult struct {
+	// Args of the simulated request
+	Args authorizer.Args
+	// Allowed is true when the policy allows the request
+	Allowed bool
+	// Statement is the statement deciding the outcome. It's nil when the
+	// owner override applied or no statement matched.
+	Statement *Statement
+	// Reason is one of ReasonExplicitDeny, ReasonOwner, ReasonAllow and
+	// ReasonImplicitDeny
+	Reason string
+}
+
+// Simulate evaluates the policy against a batch of hypothetical requests, to
+// validate a policy before using it. Results are in the order of requests.
+func Simulate(p Policy, requests []authorizer.Args) []SimulationResult {
+	results := make([]SimulationResult, len(requests))
+	for i, args := range requests {
+		allowed, statement, reason := p.Evaluate(args)
+		results[i] = SimulationResult{
+			Args:      args,
+			Allowed:   allowed,
+			Statement: statement,
+			Reason:    reason,
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/thatique/awan/authz/authorizer"
+)
+
+func TestSimulate(t *testing.T) {
+	p := testPolicy()
+	p.Statements[0].SID = "AllowObjects"
+	p.Statements[1].SID = "DenyReadonlyWrites"
+	p.Statements[2].SID = "AllowList"
+
+	requests := []authorizer.Args{
+		{Action: "GetObject", Resource: "mybucket/foo"},
+		{Action: "PutObject", Resource: "mybucket/readonly/foo"},
+		{Action: "DeleteObject", Resource: "mybucket/foo", IsOwner: true},
+		{Action: "DeleteObject", Resource: "mybucket/foo"},
+		{Action: "ListBucket", Resource: "mybucket"},
+	}
+	expected := []struct {
+		allowed bool
+		sid     string
+		reason  string
+	}{
+		{true, "AllowObjects", ReasonAllow},
+		{false, "DenyReadonlyWrites", ReasonExplicitDeny},
+		{true, "", ReasonOwner},
+		{false, "", ReasonImplicitDeny},
+		{true, "AllowList", ReasonAllow},
+	}
+
+	results := Simulate(p, requests)
+	if len(results) != len(requests) {
+		t.Fatalf("expected %d results, got %d", len(requests), len(results))
+	}
+	for i, result := range results {
+		want := expected[i]
+		sid := ""
+		if result.Statement != nil {
+			sid = result.Statement.SID
+		}
+		if result.Allowed != want.allowed || sid != want.sid || result.Reason != want.reason {
+			t.Errorf("case %v: expected (%v, %q, %q), got (%v, %q, %q)", i+1,
+				want.allowed, want.sid, want.reason, result.Allowed, sid, result.Reason)
+		}
+		if result.Args.Action != requests[i].Action {
+			t.Errorf("case %v: results out of order", i+1)
+		}
+		if result.Allowed != p.IsAllowed(requests[i]) {
+			t.Errorf("case %v: Simulate disagrees with IsAllowed", i+1)
+		}
+	}
+}
@@ -3,22 +3,46 @@ package policy
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/thatique/awan/authz/authorizer"
+	"github.com/thatique/awan/authz/policy/condition"
 )
 
 // Statement contains information about a single permission
 type Statement struct {
-	SID       string      `json:"SID,omitempty"`
-	Effect    Effect      `json:"Effect"`
-	Actions   ActionSet   `json:"Action"`
-	Resources ResourceSet `json:"Resource,omitempty"`
+	SID    string `json:"SID,omitempty"`
+	Effect Effect `json:"Effect"`
+	// Principals the statement applies to, every principal when both this and
+	// NotPrincipals are empty
+	Principals PrincipalSet `json:"Principal,omitempty"`
+	// NotPrincipals makes the statement apply to every principal except these
+	NotPrincipals PrincipalSet `json:"NotPrincipal,omitempty"`
+	Actions       ActionSet    `json:"Action,omitempty"`
+	// NotActions makes the statement apply to every action except these
+	NotActions ActionSet   `json:"NotAction,omitempty"`
+	Resources  ResourceSet `json:"Resource,omitempty"`
+	// Conditions are evaluated against the request's Metadata and
+	// condition.CurrentTime, the statement only applies when all of them hold
+	Conditions condition.Functions `json:"Condition,omitempty"`
 }
 
 // IsAllowed check if this statement allowed
 func (statement Statement) IsAllowed(args authorizer.Args) bool {
 	check := func() bool {
-		if !statement.Actions.Match(args.Action) {
+		if len(statement.Principals) > 0 && !statement.Principals.Match(args.User) {
+			return false
+		}
+
+		if len(statement.NotPrincipals) > 0 && statement.NotPrincipals.Match(args.User) {
+			return false
+		}
+
+		if len(statement.NotActions) > 0 {
+			if statement.NotActions.Match(args.Action) {
+				return false
+			}
+		} else if !statement.Actions.Match(args.Action) {
 			return false
 		}
 
@@ -26,22 +50,51 @@ func (statement Statement) IsAllowed(args authorizer.Args) bool {
 			return false
 		}
 
+		if len(statement.Conditions) > 0 && !statement.Conditions.Evaluate(conditionValues(args)) {
+			return false
+		}
+
 		return true
 	}
 
 	return statement.Effect.IsAllowed(check())
 }
 
+// timeNow is the evaluator's clock, replaced in tests
+var timeNow = time.Now
+
+// conditionValues returns the request's Metadata in the form expected by
+// condition functions, along the current time. The time always comes from the
+// evaluator's clock, so callers can't extend time bound grants through
+// Metadata.
+func conditionValues(args authorizer.Args) map[string][]string {
+	values := make(map[string][]string, len(args.Metadata)+1)
+	for k, v := range args.Metadata {
+		values[k] = []string{v}
+	}
+	values[condition.CurrentTime] = []string{timeNow().UTC().Format(time.RFC3339)}
+
+	return values
+}
+
 // IsValid - checks whether statement is valid or not.
 func (statement Statement) IsValid() error {
 	if !statement.Effect.IsValid() {
 		return fmt.Errorf("invalid Effect %v", statement.Effect)
 	}
 
-	if len(statement.Actions) == 0 {
+	if len(statement.Actions) > 0 && len(statement.NotActions) > 0 {
+		return fmt.Errorf("Action and NotAction must not be both specified")
+	}
+
+	if len(statement.Actions) == 0 && len(statement.NotActions) == 0 {
 		return fmt.Errorf("Action must not be empty")
 	}
 
+	if len(statement.Principals) > 0 && len(statement.NotPrincipals) > 0 {
+		return fmt.Errorf("Principal and NotPrincipal must not be both specified")
+	}
+
 	if len(statement.Resources) == 0 {
 		return fmt.Errorf("Resource must not be empty")
 	}
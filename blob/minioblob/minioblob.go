@@ -11,8 +11,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/thatique/awan/internal/escape"
+	"github.com/thatique/awan/verr"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/driver"
 
@@ -36,6 +39,20 @@ type Options struct {
 	// UseLegacyList forces the use of ListObjects instead of ListObjectsV2.
 	// ListObjectsV2.
 	UseLegacyList bool
+
+	// Region is the region of the bucket. It is only used by URLOpener when
+	// it constructs the minio client; leave it empty to let the client
+	// discover the region.
+	Region string
+
+	// PathStyle forces path-style addressing (host/bucket/key) instead of
+	// virtual-host-style addressing. Like Region, it is only used by
+	// URLOpener when it constructs the minio client.
+	PathStyle bool
+
+	// DefaultMetadata is merged into the metadata of every object written
+	// through the bucket. Keys given in WriterOptions.Metadata win over these.
+	DefaultMetadata map[string]string
 }
 
 // URLOpener implements blob url opener for minio
@@ -44,42 +61,145 @@ type URLOpener struct {
 }
 
 type bucket struct {
-	name          string
-	core          *minio.Core
-	client        *minio.Client
-	useLegacyList bool
+	name            string
+	core            *minio.Core
+	client          *minio.Client
+	useLegacyList   bool
+	defaultMetadata map[string]string
 }
 
 // OpenBucketURL open bucket
+//
+// The following query parameters are supported:
+//
+//   - ssl: set to 1 to connect over TLS.
+//   - legacylist: set to 1 to use ListObjects instead of ListObjectsV2.
+//   - region: the region of the bucket, overrides Options.Region.
+//   - pathstyle: set to 1 to force path-style addressing, or 0 to disable it,
+//     overrides Options.PathStyle.
+//
+// Any other query parameter is rejected.
 func (o *URLOpener) OpenBucketURL(ctx context.Context, u *url.URL) (*blob.Bucket, error) {
-	q := u.Query()
-
-	useSSL := false
-	if i, err := strconv.Atoi(q.Get("ssl")); err != nil && i > 0 {
-		useSSL = true
+	options, clientOptions, err := o.parseQuery(u.Query())
+	if err != nil {
+		return nil, fmt.Errorf("open bucket %v: %v", u, err)
 	}
-	client, err := minio.New(u.Host, &minio.Options{
-		Creds:  credentials.NewEnvMinio(),
-		Secure: useSSL,
-	})
+	client, err := minio.New(u.Host, clientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("open bucket %v: %v", u, err)
 	}
-	options := &Options{}
-	if i, err := strconv.Atoi(q.Get("legacylist")); err != nil && i > 0 {
+	bucketName := strings.Trim(u.Path, "/")
+	if bucketName == "" {
+		return nil, fmt.Errorf("open bucket %v: bucket name is required", u)
+	}
+	return OpenBucket(ctx, client, bucketName, options)
+}
+
+// urlParams are the query parameters recognized by URLOpener.
+var urlParams = []string{"ssl", "legacylist", "region", "pathstyle"}
+
+// checkQuery returns an error if q holds a parameter not in allowed.
+func checkQuery(q url.Values, allowed ...string) error {
+	for param := range q {
+		known := false
+		for _, a := range allowed {
+			if param == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid query parameter %q", param)
+		}
+	}
+	return nil
+}
+
+// parseQuery returns the bucket options and the minio client options for the
+// query of a bucket URL.
+func (o *URLOpener) parseQuery(q url.Values) (*Options, *minio.Options, error) {
+	if err := checkQuery(q, urlParams...); err != nil {
+		return nil, nil, err
+	}
+
+	options := o.Options
+	if i, err := strconv.Atoi(q.Get("legacylist")); err == nil && i > 0 {
 		options.UseLegacyList = true
 	}
-	bucketName := u.Path
-	i := 0
-	e := -1
-	if bucketName[0] == '/' {
-		i++
+	if region := q.Get("region"); region != "" {
+		options.Region = region
 	}
-	if bucketName[len(bucketName)-1] == '/' {
-		e--
+	if i, err := strconv.Atoi(q.Get("pathstyle")); err == nil {
+		options.PathStyle = i > 0
 	}
-	bucketName = bucketName[i:e]
-	return OpenBucket(ctx, client, bucketName, options)
+
+	useSSL := false
+	if i, err := strconv.Atoi(q.Get("ssl")); err == nil && i > 0 {
+		useSSL = true
+	}
+	lookup := minio.BucketLookupAuto
+	if options.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	return &options, &minio.Options{
+		Creds:        credentials.NewEnvMinio(),
+		Secure:       useSSL,
+		Region:       options.Region,
+		BucketLookup: lookup,
+	}, nil
+}
+
+var (
+	clientsMu sync.RWMutex
+	clients   = map[string]*minio.Client{}
+)
+
+// RegisterClient makes blob.OpenBucket(ctx, name+"://bucket") open the bucket
+// with the given, already configured, client. The first registration of a
+// name registers it as a scheme on blob.DefaultURLMux, which panics if another
+// opener already uses that scheme; registering the name again replaces the
+// client.
+func RegisterClient(name string, client *minio.Client) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if _, ok := clients[name]; !ok {
+		blob.DefaultURLMux().RegisterBucket(name, new(ClientURLOpener))
+	}
+	clients[name] = client
+}
+
+// ClientURLOpener opens bucket URLs like "name://bucket", using the client
+// registered with RegisterClient under the URL's scheme.
+//
+// The following query parameters are supported:
+//
+//   - legacylist: set to 1 to use ListObjects instead of ListObjectsV2.
+//
+// Any other query parameter is rejected.
+type ClientURLOpener struct {
+	Options Options
+}
+
+// OpenBucketURL opens the bucket named by the URL's host.
+func (o *ClientURLOpener) OpenBucketURL(ctx context.Context, u *url.URL) (*blob.Bucket, error) {
+	clientsMu.RLock()
+	client, ok := clients[u.Scheme]
+	clientsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("open bucket %v: no client registered for scheme %q", u, u.Scheme)
+	}
+
+	q := u.Query()
+	if err := checkQuery(q, "legacylist"); err != nil {
+		return nil, fmt.Errorf("open bucket %v: %v", u, err)
+	}
+
+	options := o.Options
+	if i, err := strconv.Atoi(q.Get("legacylist")); err == nil && i > 0 {
+		options.UseLegacyList = true
+	}
+	return OpenBucket(ctx, client, u.Host, &options)
 }
 
 // OpenBucket returns a *blob.Bucket backed by S3.
@@ -102,7 +222,33 @@ func openBucket(ctx context.Context, client *minio.Client, bucketName string, op
 	if opts == nil {
 		opts = &Options{}
 	}
-	return &bucket{name: bucketName, client: client, core: &minio.Core{client}, useLegacyList: opts.UseLegacyList}, nil
+	if err := validateMetadata(opts.DefaultMetadata); err != nil {
+		return nil, fmt.Errorf("s3blob.OpenBucket: DefaultMetadata %v", err)
+	}
+	return &bucket{
+		name:            bucketName,
+		client:          client,
+		core:            &minio.Core{Client: client},
+		useLegacyList:   opts.UseLegacyList,
+		defaultMetadata: opts.DefaultMetadata,
+	}, nil
+}
+
+// validateMetadata checks the metadata keys the same way blob.NewWriter
+// checks WriterOptions.Metadata
+func validateMetadata(metadata map[string]string) error {
+	lowerKeys := make(map[string]bool, len(metadata))
+	for k := range metadata {
+		if !utf8.ValidString(k) {
+			return fmt.Errorf("keys must be valid UTF-8 strings: %q", k)
+		}
+		lowerKey := strings.ToLower(k)
+		if lowerKeys[lowerKey] {
+			return fmt.Errorf("duplicate case-insensitive key %q", lowerKey)
+		}
+		lowerKeys[lowerKey] = true
+	}
+	return nil
 }
 
 type reader struct {
@@ -173,13 +319,18 @@ func (w *writer) Write(p []byte) (int, error) {
 func (w *writer) open(pr *io.PipeReader) error {
 	go func() {
 		defer close(w.donec)
-		var r io.Reader
+		var (
+			r    io.Reader
+			size int64 = -1
+		)
 		if pr == nil {
-			r = http.NoBody
+			// A known zero size makes a single PUT, so the ETag is the MD5
+			// of empty content rather than a multipart ETag.
+			r, size = http.NoBody, 0
 		} else {
 			r = pr
 		}
-		_, err := w.c.PutObject(w.ctx, w.bucketName, w.objectName, r, -1, w.opts)
+		_, err := w.c.PutObject(w.ctx, w.bucketName, w.objectName, r, size, w.opts)
 		if err != nil {
 			w.err = err
 			if pr != nil {
@@ -211,11 +362,23 @@ func (b *bucket) Close() error {
 
 func (b *bucket) ErrorCode(err error) gcerrors.ErrorCode {
 	reserr := minio.ToErrorResponse(err)
-	switch {
-	case reserr.Code == "AccessDenied":
+	switch verr.FromProviderCode(verr.S3, reserr.Code) {
+	case verr.PermissionDenied, verr.Unauthenticated:
 		return gcerrors.PermissionDenied
-	case reserr.Code == "NoSuchKey" || reserr.Code == "NotFound" || reserr.Code == "NoSuchBucket":
+	case verr.NotFound:
 		return gcerrors.NotFound
+	case verr.AlreadyExists:
+		return gcerrors.AlreadyExists
+	case verr.InvalidArgument:
+		return gcerrors.InvalidArgument
+	case verr.FailedPrecondition:
+		return gcerrors.FailedPrecondition
+	case verr.Unimplemented:
+		return gcerrors.Unimplemented
+	case verr.Internal:
+		return gcerrors.Internal
+	case verr.ResourceExhausted:
+		return gcerrors.ResourceExhausted
 	default:
 		return gcerrors.Unknown
 	}
@@ -235,7 +398,27 @@ func (b *bucket) ListPaged(ctx context.Context, opts *driver.ListOptions) (*driv
 		pageSize = defaultPageSize
 	}
 
-	res, err := b.listObjects(ctx, prefix, string(opts.PageToken), delimiter, pageSize)
+	// BeforeList may change the Prefix and MaxKeys of the request, or switch
+	// it to the V1 API with UseV1. The other fields are ignored.
+	listOptions := minio.ListObjectsOptions{
+		Prefix:  prefix,
+		MaxKeys: pageSize,
+		UseV1:   b.useLegacyList,
+	}
+	if opts.BeforeList != nil {
+		asFunc := func(i interface{}) bool {
+			if p, ok := i.(**minio.ListObjectsOptions); ok {
+				*p = &listOptions
+				return true
+			}
+			return false
+		}
+		if err := opts.BeforeList(asFunc); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := b.listObjects(ctx, string(opts.PageToken), delimiter, listOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -285,12 +468,12 @@ func (b *bucket) ListPaged(ctx context.Context, opts *driver.ListOptions) (*driv
 	return &page, nil
 }
 
-func (b *bucket) listObjects(ctx context.Context, prefix, token, delimiter string, pageSize int) (minio.ListBucketV2Result, error) {
-	if !b.useLegacyList {
-		return b.core.ListObjectsV2(b.name, prefix, token, true, delimiter, pageSize)
+func (b *bucket) listObjects(ctx context.Context, token, delimiter string, opts minio.ListObjectsOptions) (minio.ListBucketV2Result, error) {
+	if !opts.UseV1 {
+		return b.core.ListObjectsV2(b.name, opts.Prefix, token, true, delimiter, opts.MaxKeys)
 	}
 
-	res, err := b.core.ListObjects(b.name, prefix, token, delimiter, pageSize)
+	res, err := b.core.ListObjects(b.name, opts.Prefix, token, delimiter, opts.MaxKeys)
 	if err != nil {
 		return minio.ListBucketV2Result{}, err
 	}
@@ -384,26 +567,76 @@ func (b *bucket) NewRangeReader(ctx context.Context, key string, offset, length
 		}
 	}
 
-	obj, err := b.client.GetObject(ctx, b.name, key, objectOptions)
+	// a single GET, minio.Object drops the Range header when it is stat'ed
+	// before being read
+	body, info, header, err := b.core.GetObject(ctx, b.name, key, objectOptions)
 	if err != nil {
-		return nil, err
+		if minio.ToErrorResponse(err).Code != "InvalidRange" {
+			return nil, err
+		}
+		// the range starts at or past the end of the object, e.g. a read at
+		// EOF or of an empty object, which reads nothing rather than fail
+		rangeErr := err
+		if info, err = b.client.StatObject(ctx, b.name, key, withoutRange(objectOptions)); err != nil {
+			return nil, err
+		}
+		if offset < getSize(info, nil) {
+			return nil, rangeErr
+		}
+		body, length = http.NoBody, 0
+	}
+
+	if length == 0 {
+		body.Close()
+		body = http.NoBody
 	}
-	info, err := obj.Stat()
 
 	return &reader{
-		body: obj,
+		body: body,
 		attrs: driver.ReaderAttributes{
 			ContentType: info.ContentType,
 			ModTime:     info.LastModified,
-			Size:        getSize(info),
+			Size:        getSize(info, header),
 		},
 	}, nil
 }
 
+// withoutRange returns a copy of opts without its Range header, the headers
+// map of GetObjectOptions is shared by plain copies.
+func withoutRange(opts minio.GetObjectOptions) minio.StatObjectOptions {
+	statOptions := minio.StatObjectOptions{
+		ServerSideEncryption: opts.ServerSideEncryption,
+		VersionID:            opts.VersionID,
+	}
+	for k, v := range opts.Header() {
+		if k != "Range" && len(v) > 0 {
+			statOptions.Set(k, v[0])
+		}
+	}
+	return statOptions
+}
+
 func (b *bucket) NewTypedWriter(ctx context.Context, key, contentType string, opts *driver.WriterOptions) (driver.Writer, error) {
 	key = escapeKey(key, false)
-	md := make(map[string]string, len(opts.Metadata))
-	for k, v := range opts.Metadata {
+	// merged on the lower-cased keys, S3 doesn't preserve their case so a
+	// per-call key replaces the default differing only in case
+	metadata := make(map[string]string, len(b.defaultMetadata)+len(opts.Metadata))
+	keys := make(map[string]string, len(b.defaultMetadata)+len(opts.Metadata))
+	for _, m := range []map[string]string{b.defaultMetadata, opts.Metadata} {
+		for k, v := range m {
+			lowerKey := strings.ToLower(k)
+			if prev, ok := keys[lowerKey]; ok {
+				delete(metadata, prev)
+			}
+			keys[lowerKey] = k
+			metadata[k] = v
+		}
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return nil, fmt.Errorf("minioblob: Metadata %v", err)
+	}
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
 		// See the package comments for more details on escaping of metadata
 		// keys & values.
 		k = escape.HexEscape(url.PathEscape(k), func(runes []rune, i int) bool {
@@ -489,14 +722,27 @@ func (b *bucket) Copy(ctx context.Context, dstKey, srcKey string, opts *driver.C
 }
 
 func (b *bucket) Delete(ctx context.Context, key string) error {
-	if _, err := b.Attributes(ctx, key); err != nil {
+	key = escapeKey(key, false)
+	// S3 and minio answer 204 to deletes of missing keys, so a HEAD is the
+	// only way to report NotFound
+	if _, err := b.client.StatObject(ctx, b.name, key, minio.StatObjectOptions{}); err != nil {
 		return err
 	}
-	key = escapeKey(key, false)
 	return b.client.RemoveObject(ctx, b.name, key, minio.RemoveObjectOptions{})
 }
 
+// SignedURL presigns the URL with the query parameters only, the signature
+// can't cover the Content-Type header so a PUT URL pinning it, or its
+// absence, is Unimplemented. It can't cover the size of the upload either,
+// S3 only limits it in the policy of a presigned POST form, which isn't a
+// URL.
 func (b *bucket) SignedURL(ctx context.Context, key string, opts *driver.SignedURLOptions) (string, error) {
+	if opts.ContentType != "" || opts.EnforceAbsentContentType {
+		return "", minio.ErrorResponse{
+			Code:    "NotImplemented",
+			Message: "minioblob: signed URLs can't enforce the Content-Type",
+		}
+	}
 	key = escapeKey(key, false)
 	url, err := b.client.Presign(ctx, opts.Method, b.name, key, opts.Expiry, nil)
 	if err != nil {
@@ -618,9 +864,11 @@ func eTagToMD5(etag *string) []byte {
 	return md5
 }
 
-func getSize(obj minio.ObjectInfo) int64 {
+// getSize returns the size of the whole object, the total of the
+// Content-Range header of a range read
+func getSize(obj minio.ObjectInfo, header http.Header) int64 {
 	size := obj.Size
-	if cr := obj.Metadata.Get("Content-Range"); cr != "" {
+	if cr := header.Get("Content-Range"); cr != "" {
 		parts := strings.Split(cr, "/")
 		if len(parts) == 2 {
 			if i, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
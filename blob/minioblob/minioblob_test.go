@@ -3,9 +3,18 @@ package minioblob
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/minio/minio-go/v7"
@@ -14,6 +23,7 @@ import (
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/driver"
 	"gocloud.dev/blob/drivertest"
+	"gocloud.dev/gcerrors"
 )
 
 const (
@@ -78,6 +88,530 @@ func TestEscapeKey(t *testing.T) {
 	}
 }
 
+func TestParseQuery(t *testing.T) {
+	testCases := []struct {
+		query        string
+		base         Options
+		region       string
+		pathStyle    bool
+		bucketLookup minio.BucketLookupType
+	}{
+		{"", Options{}, "", false, minio.BucketLookupAuto},
+		{"region=us-west-1", Options{}, "us-west-1", false, minio.BucketLookupAuto},
+		{"pathstyle=1", Options{}, "", true, minio.BucketLookupPath},
+		{"pathstyle=0", Options{PathStyle: true}, "", false, minio.BucketLookupAuto},
+		{"region=eu-west-2&pathstyle=1", Options{Region: "us-east-1"}, "eu-west-2", true, minio.BucketLookupPath},
+		{"", Options{Region: "us-east-1", PathStyle: true}, "us-east-1", true, minio.BucketLookupPath},
+	}
+
+	for i, testCase := range testCases {
+		q, err := url.ParseQuery(testCase.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := &URLOpener{Options: testCase.base}
+		opts, clientOpts, err := o.parseQuery(q)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i+1, err)
+		}
+		if opts.Region != testCase.region || clientOpts.Region != testCase.region {
+			t.Errorf("case %d: expected region %q, got %q (client %q)", i+1, testCase.region, opts.Region, clientOpts.Region)
+		}
+		if opts.PathStyle != testCase.pathStyle {
+			t.Errorf("case %d: expected PathStyle %v, got %v", i+1, testCase.pathStyle, opts.PathStyle)
+		}
+		if clientOpts.BucketLookup != testCase.bucketLookup {
+			t.Errorf("case %d: expected BucketLookup %v, got %v", i+1, testCase.bucketLookup, clientOpts.BucketLookup)
+		}
+	}
+}
+
+func TestOpenBucketURL(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		url           string
+		secure        bool
+		useLegacyList bool
+		wantErr       bool
+	}{
+		{"minio://localhost:9000/mybucket", false, false, false},
+		{"minio://localhost:9000/mybucket/", false, false, false},
+		{"minio://localhost:9000/mybucket?ssl=1", true, false, false},
+		{"minio://localhost:9000/mybucket?ssl=0", false, false, false},
+		{"minio://localhost:9000/mybucket?legacylist=1", false, true, false},
+		{"minio://localhost:9000/mybucket?ssl=1&legacylist=1", true, true, false},
+		{"minio://localhost:9000", false, false, true},
+		{"minio://localhost:9000/", false, false, true},
+	}
+
+	for i, testCase := range testCases {
+		u, err := url.Parse(testCase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := &URLOpener{}
+		opts, clientOpts, err := o.parseQuery(u.Query())
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i+1, err)
+		}
+		if clientOpts.Secure != testCase.secure {
+			t.Errorf("case %d: expected Secure %v, got %v", i+1, testCase.secure, clientOpts.Secure)
+		}
+		if opts.UseLegacyList != testCase.useLegacyList {
+			t.Errorf("case %d: expected UseLegacyList %v, got %v", i+1, testCase.useLegacyList, opts.UseLegacyList)
+		}
+
+		b, err := o.OpenBucketURL(ctx, u)
+		if (err != nil) != testCase.wantErr {
+			t.Errorf("case %d: got err %v, want error %v", i+1, err, testCase.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var client *minio.Client
+		if !b.As(&client) {
+			t.Fatalf("case %d: Bucket.As failed", i+1)
+		}
+		if scheme := client.EndpointURL().Scheme; (scheme == "https") != testCase.secure {
+			t.Errorf("case %d: unexpected endpoint scheme %q", i+1, scheme)
+		}
+	}
+}
+
+func TestOpenBucketURLUnknownQuery(t *testing.T) {
+	ctx := context.Background()
+	client, err := minio.New("localhost:9000", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterClient("testminiounknown", client)
+
+	testCases := []string{
+		"minio://localhost:9000/mybucket?foo=1",
+		"minio://localhost:9000/mybucket?ssl=1&acl=private",
+		"minio://localhost:9000/mybucket?Region=us-east-1",
+		"testminiounknown://mybucket?region=us-east-1",
+		"testminiounknown://mybucket?legacylist=1&foo=bar",
+	}
+	for _, testCase := range testCases {
+		if _, err := blob.OpenBucket(ctx, testCase); err == nil || !strings.Contains(err.Error(), "invalid query parameter") {
+			t.Errorf("%s: expected an invalid query parameter error, got %v", testCase, err)
+		}
+	}
+}
+
+func TestRegisterClient(t *testing.T) {
+	ctx := context.Background()
+	client, err := minio.New("localhost:9000", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterClient("testminio", client)
+
+	b, err := blob.OpenBucket(ctx, "testminio://mybucket?legacylist=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var got *minio.Client
+	if !b.As(&got) {
+		t.Fatal("Bucket.As failed")
+	}
+	if got != client {
+		t.Error("expected the bucket to use the registered client")
+	}
+
+	// registering the name again replaces the client
+	other, err := minio.New("localhost:9001", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterClient("testminio", other)
+	b2, err := blob.OpenBucket(ctx, "testminio://mybucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+	if !b2.As(&got) || got != other {
+		t.Error("expected the bucket to use the replaced client")
+	}
+
+	if _, err = (&ClientURLOpener{}).OpenBucketURL(ctx, &url.URL{Scheme: "unknownminio", Host: "mybucket"}); err == nil {
+		t.Error("expected an error for a scheme without client")
+	}
+}
+
+// newFakeBucket opens a bucket with opts on a server answering every request
+// with handler, a nil handler answers 404. The returned func closes the
+// server.
+func newFakeBucket(t *testing.T, handler http.Handler, opts *Options) (*bucket, func()) {
+	if handler == nil {
+		handler = http.NotFoundHandler()
+	}
+	srv := httptest.NewServer(handler)
+	u, _ := url.Parse(srv.URL)
+	c, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	drv, err := openBucket(context.Background(), c, minioBucketName, opts)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return drv, srv.Close
+}
+
+// newDeleteBucket opens a bucket on a server behaving like S3 for deletes:
+// HEAD finds the key only when exists is set, and DELETE always answers 204.
+// It returns the methods of the requests the server received.
+func newDeleteBucket(t *testing.T, exists bool) (*blob.Bucket, func() []string, func()) {
+	var mu sync.Mutex
+	var methods []string
+	drv, closeSrv := newFakeBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case exists:
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Content-Length", "0")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}), nil)
+	received := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), methods...)
+	}
+	return blob.NewBucket(drv), received, closeSrv
+}
+
+func TestDeleteMissingKey(t *testing.T) {
+	b, received, closeSrv := newDeleteBucket(t, false)
+	defer closeSrv()
+
+	err := b.Delete(context.Background(), "does-not-exist")
+	if gcerrors.Code(err) != gcerrors.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	if methods := received(); len(methods) != 1 || methods[0] != http.MethodHead {
+		t.Errorf("expected a single HEAD, got %v", methods)
+	}
+}
+
+func TestDeleteExistingKey(t *testing.T) {
+	b, received, closeSrv := newDeleteBucket(t, true)
+	defer closeSrv()
+
+	if err := b.Delete(context.Background(), "exists"); err != nil {
+		t.Fatal(err)
+	}
+	if methods := received(); strings.Join(methods, ",") != "HEAD,DELETE" {
+		t.Errorf("expected a HEAD then a DELETE, got %v", methods)
+	}
+}
+
+// serveObject answers the GET and HEAD requests of key with data, honoring
+// the Range header the way S3 does.
+func serveObject(key string, data []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/"+key) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", "text/plain")
+		size := int64(len(data))
+		start, end := int64(0), size-1
+		spec := strings.TrimPrefix(r.Header.Get("Range"), "bytes=")
+		if spec != "" && r.Method == http.MethodGet {
+			parts := strings.SplitN(spec, "-", 2)
+			start, _ = strconv.ParseInt(parts[0], 10, 64)
+			if parts[1] != "" {
+				end, _ = strconv.ParseInt(parts[1], 10, 64)
+			}
+			if start >= size {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+					`<Error><Code>InvalidRange</Code><Message>The requested range is not satisfiable</Message></Error>`))
+				return
+			}
+			if end >= size {
+				end = size - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		if r.Method == http.MethodGet {
+			w.Write(data[start : end+1])
+		}
+	}
+}
+
+func TestNewRangeReaderBounds(t *testing.T) {
+	testCases := []struct {
+		data           string
+		offset, length int64
+		expected       string
+	}{
+		{"hello world", 0, 100, "hello world"},
+		{"hello world", 6, 100, "world"},
+		{"hello world", 11, -1, ""},
+		{"hello world", 11, 0, ""},
+		{"hello world", 11, 5, ""},
+		{"hello world", 20, -1, ""},
+		{"", 0, -1, ""},
+		{"", 0, 0, ""},
+		{"", 0, 5, ""},
+	}
+
+	for i, testCase := range testCases {
+		drv, closeSrv := newFakeBucket(t, serveObject("key", []byte(testCase.data)), nil)
+		b := blob.NewBucket(drv)
+
+		r, err := b.NewRangeReader(context.Background(), "key", testCase.offset, testCase.length, nil)
+		if err != nil {
+			t.Errorf("case %d: %v", i+1, err)
+			closeSrv()
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("case %d: %v", i+1, err)
+		} else if string(got) != testCase.expected {
+			t.Errorf("case %d: expected %q, got %q", i+1, testCase.expected, got)
+		}
+		if r.Size() != int64(len(testCase.data)) {
+			t.Errorf("case %d: expected size %d, got %d", i+1, len(testCase.data), r.Size())
+		}
+		closeSrv()
+	}
+}
+
+func TestListBeforeList(t *testing.T) {
+	var query url.Values
+	drv, closeSrv := newFakeBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<ListBucketResult><Name>` + minioBucketName + `</Name><IsTruncated>false</IsTruncated></ListBucketResult>`))
+	}), nil)
+	defer closeSrv()
+	b := blob.NewBucket(drv)
+
+	iter := b.List(&blob.ListOptions{
+		Prefix: "dir/",
+		BeforeList: func(as func(interface{}) bool) error {
+			var opts *minio.ListObjectsOptions
+			if !as(&opts) {
+				return errors.New("BeforeList.As failed")
+			}
+			if opts.Prefix != "dir/" {
+				t.Errorf("expected prefix %q, got %q", "dir/", opts.Prefix)
+			}
+			opts.MaxKeys = 7
+			opts.UseV1 = true
+			return nil
+		},
+	})
+	if _, err := iter.Next(context.Background()); err != io.EOF {
+		t.Fatalf("expected an empty listing, got %v", err)
+	}
+	if got := query.Get("max-keys"); got != "7" {
+		t.Errorf("expected max-keys 7, got %q", got)
+	}
+	if got := query.Get("list-type"); got != "" {
+		t.Errorf("expected the V1 API, got list-type %q", got)
+	}
+	if got := query.Get("prefix"); got != "dir/" {
+		t.Errorf("expected prefix %q, got %q", "dir/", got)
+	}
+}
+
+func TestCopyMissingSource(t *testing.T) {
+	drv, closeSrv := newFakeBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+	}), nil)
+	defer closeSrv()
+	b := blob.NewBucket(drv)
+
+	err := b.Copy(context.Background(), "dst", "does-not-exist", nil)
+	if gcerrors.Code(err) != gcerrors.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+func TestEmptyObjectWrite(t *testing.T) {
+	const emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+
+	var puts, multipart int32
+	drv, closeSrv := newFakeBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["uploads"]; ok {
+			atomic.AddInt32(&multipart, 1)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if r.Method == http.MethodPut {
+			atomic.AddInt32(&puts, 1)
+			// over plain HTTP the client uses a streaming signature, so
+			// the payload size is in a header instead of Content-Length
+			size := r.Header.Get("X-Amz-Decoded-Content-Length")
+			if size == "" {
+				size = strconv.FormatInt(r.ContentLength, 10)
+			}
+			if size != "0" {
+				t.Errorf("expected an empty object, got size %s", size)
+			}
+			w.Header().Set("ETag", `"`+emptyMD5+`"`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}), nil)
+	defer closeSrv()
+	b := blob.NewBucket(drv)
+
+	w, err := b.NewWriter(context.Background(), "empty", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&puts) != 1 || atomic.LoadInt32(&multipart) != 0 {
+		t.Errorf("expected a single PUT and no multipart upload, got %d and %d", puts, multipart)
+	}
+}
+
+func TestDefaultMetadata(t *testing.T) {
+	ctx := context.Background()
+	drv, closeSrv := newFakeBucket(t, nil, &Options{
+		DefaultMetadata: map[string]string{"app": "frontend", "env": "prod"},
+	})
+	defer closeSrv()
+
+	var got map[string]string
+	w, err := drv.NewTypedWriter(ctx, "key", "text/plain", &driver.WriterOptions{
+		Metadata: map[string]string{"env": "staging", "owner": "me"},
+		BeforeWrite: func(as func(interface{}) bool) error {
+			var po minio.PutObjectOptions
+			if !as(&po) {
+				return errors.New("BeforeWrite As failed")
+			}
+			got = po.UserMetadata
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w == nil {
+		t.Fatal("expected a writer")
+	}
+
+	want := map[string]string{"app": "frontend", "env": "staging", "owner": "me"}
+	if len(got) != len(want) {
+		t.Fatalf("got metadata %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("metadata %q: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestDefaultMetadataCaseInsensitiveOverride(t *testing.T) {
+	ctx := context.Background()
+	drv, closeSrv := newFakeBucket(t, nil, &Options{
+		DefaultMetadata: map[string]string{"app": "frontend", "env": "prod"},
+	})
+	defer closeSrv()
+
+	var got map[string]string
+	_, err := drv.NewTypedWriter(ctx, "key", "text/plain", &driver.WriterOptions{
+		Metadata: map[string]string{"Env": "staging"},
+		BeforeWrite: func(as func(interface{}) bool) error {
+			var po minio.PutObjectOptions
+			if !as(&po) {
+				return errors.New("BeforeWrite As failed")
+			}
+			got = po.UserMetadata
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["Env"] != "staging" || got["app"] != "frontend" {
+		t.Errorf("expected the per-call Env to replace the default env, got %v", got)
+	}
+}
+
+func TestDefaultMetadataInvalidKeys(t *testing.T) {
+	c, err := minio.New("localhost:9000", &minio.Options{
+		Creds: credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, metadata := range []map[string]string{
+		{"\xff": "invalid"},
+		{"App": "frontend", "app": "backend"},
+	} {
+		if _, err := openBucket(context.Background(), c, minioBucketName, &Options{DefaultMetadata: metadata}); err == nil {
+			t.Errorf("expected DefaultMetadata %q to be rejected", metadata)
+		}
+	}
+}
+
+func TestSignedURLContentType(t *testing.T) {
+	ctx := context.Background()
+	drv, closeSrv := newFakeBucket(t, nil, nil)
+	defer closeSrv()
+	b := blob.NewBucket(drv)
+
+	_, err := b.SignedURL(ctx, "key", &blob.SignedURLOptions{Method: http.MethodPut, ContentType: "text/plain"})
+	if gcerrors.Code(err) != gcerrors.Unimplemented {
+		t.Errorf("expected Unimplemented for a pinned Content-Type, got %v", err)
+	}
+	_, err = b.SignedURL(ctx, "key", &blob.SignedURLOptions{Method: http.MethodPut, EnforceAbsentContentType: true})
+	if gcerrors.Code(err) != gcerrors.Unimplemented {
+		t.Errorf("expected Unimplemented for an enforced absent Content-Type, got %v", err)
+	}
+	signed, err := b.SignedURL(ctx, "key", &blob.SignedURLOptions{Method: http.MethodPut})
+	if err != nil {
+		t.Fatalf("expected an unconstrained PUT URL, got %v", err)
+	}
+	// only the host is signed, neither the Content-Type nor the size of the
+	// upload are constrained
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("X-Amz-SignedHeaders"); got != "host" {
+		t.Errorf("expected only the host to be signed, got %q", got)
+	}
+}
+
 func TestConformance(t *testing.T) {
 	drivertest.RunConformanceTests(t, newHarness, []drivertest.AsTest{verifyContentLanguage{usingLegacyList: false}})
 }
@@ -140,7 +674,10 @@ func (verifyContentLanguage) BeforeCopy(as func(interface{}) bool) error {
 }
 
 func (v verifyContentLanguage) BeforeList(as func(interface{}) bool) error {
-	// Nothing to do.
+	var opts *minio.ListObjectsOptions
+	if !as(&opts) {
+		return errors.New("BeforeList.As failed")
+	}
 	return nil
 }
 
@@ -10,3 +10,13 @@ type CookieOptions struct {
 	Secure   bool
 	HTTPOnly bool
 }
+
+// NewSecureCookieOptions returns CookieOptions for cookies only sent over
+// HTTPS and hidden from scripts.
+func NewSecureCookieOptions() *CookieOptions {
+	return &CookieOptions{
+		Path:     "/",
+		Secure:   true,
+		HTTPOnly: true,
+	}
+}
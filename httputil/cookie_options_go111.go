@@ -14,3 +14,15 @@ type CookieOptions struct {
 	// Default to http.SameSiteDefaultMode
 	SameSite http.SameSite
 }
+
+// NewSecureCookieOptions returns CookieOptions for cookies only sent over
+// HTTPS, hidden from scripts and not sent along cross-site requests except
+// top-level navigations (SameSite=Lax).
+func NewSecureCookieOptions() *CookieOptions {
+	return &CookieOptions{
+		Path:     "/",
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
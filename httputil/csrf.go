@@ -0,0 +1,92 @@
+package httputil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	// CSRFHeaderName is the request header checked for the CSRF token
+	CSRFHeaderName = "X-CSRF-Token"
+
+	// CSRFFieldName is the form field checked for the CSRF token when the
+	// header is not set
+	CSRFFieldName = "csrf_token"
+)
+
+// CSRF protects handlers against cross site request forgery. Its tokens are
+// an HMAC of the session ID, so they are valid as long as the session keeps
+// its ID and can't be forged without the key.
+type CSRF struct {
+	key       []byte
+	sessionID func(r *http.Request) string
+
+	// ErrorHandler is called when a request is rejected. Default to a plain
+	// 403 Forbidden response.
+	ErrorHandler http.Handler
+}
+
+// NewCSRF returns a CSRF signing tokens with key. sessionID returns the
+// session ID of a request, or an empty string if it has none, e.g.
+// session.SessionID.
+func NewCSRF(key []byte, sessionID func(r *http.Request) string) *CSRF {
+	return &CSRF{key: key, sessionID: sessionID}
+}
+
+// Token returns the token to embed in the forms or the CSRFHeaderName header
+// of the requests made by the page. It is empty when the request has no
+// session yet.
+func (c *CSRF) Token(r *http.Request) string {
+	sid := c.sessionID(r)
+	if sid == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(c.sign(sid))
+}
+
+// Valid reports whether token is the CSRF token of the request's session
+func (c *CSRF) Valid(r *http.Request, token string) bool {
+	sid := c.sessionID(r)
+	if sid == "" || token == "" {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, c.sign(sid))
+}
+
+// Middleware rejects the requests with an unsafe method whose CSRFHeaderName
+// header, or CSRFFieldName form field, is not a valid token.
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(CSRFHeaderName)
+		if token == "" {
+			token = r.PostFormValue(CSRFFieldName)
+		}
+		if !c.Valid(r, token) {
+			if c.ErrorHandler != nil {
+				c.ErrorHandler.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CSRF) sign(sid string) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(sid))
+	return h.Sum(nil)
+}
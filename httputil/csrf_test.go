@@ -0,0 +1,81 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestCSRF() *CSRF {
+	return NewCSRF([]byte("0123456789abcdef0123456789abcdef"), func(r *http.Request) string {
+		return r.Header.Get("X-Session")
+	})
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	csrf := newTestCSRF()
+	handler := csrf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tokenReq := httptest.NewRequest("GET", "/", nil)
+	tokenReq.Header.Set("X-Session", "session-id")
+	token := csrf.Token(tokenReq)
+	if token == "" {
+		t.Fatal("expected a token")
+	}
+
+	forged := NewCSRF([]byte("another key"), func(r *http.Request) string { return "session-id" }).Token(tokenReq)
+	otherSession := csrf.Token(func() *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Session", "other-session")
+		return r
+	}())
+
+	testCases := []struct {
+		name     string
+		method   string
+		session  string
+		header   string
+		field    string
+		expected int
+	}{
+		{"safe method", "GET", "session-id", "", "", http.StatusNoContent},
+		{"valid header", "POST", "session-id", token, "", http.StatusNoContent},
+		{"valid form field", "POST", "session-id", "", token, http.StatusNoContent},
+		{"missing", "POST", "session-id", "", "", http.StatusForbidden},
+		{"forged", "DELETE", "session-id", forged, "", http.StatusForbidden},
+		{"other session", "POST", "session-id", otherSession, "", http.StatusForbidden},
+		{"malformed", "POST", "session-id", "not base64!", "", http.StatusForbidden},
+		{"no session", "POST", "", token, "", http.StatusForbidden},
+	}
+
+	for _, testCase := range testCases {
+		form := url.Values{}
+		if testCase.field != "" {
+			form.Set(CSRFFieldName, testCase.field)
+		}
+		req := httptest.NewRequest(testCase.method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if testCase.session != "" {
+			req.Header.Set("X-Session", testCase.session)
+		}
+		if testCase.header != "" {
+			req.Header.Set(CSRFHeaderName, testCase.header)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expected {
+			t.Errorf("%s: expected status %d, got %d", testCase.name, testCase.expected, rec.Code)
+		}
+	}
+}
+
+func TestCSRFTokenWithoutSession(t *testing.T) {
+	if token := newTestCSRF().Token(httptest.NewRequest("GET", "/", nil)); token != "" {
+		t.Errorf("expected no token without a session, got %q", token)
+	}
+}
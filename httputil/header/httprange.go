@@ -3,6 +3,7 @@ package header
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -14,6 +15,10 @@ const (
 var (
 	// ErrInvalidHTTPRange thrown when we encounter invalid Spec
 	ErrInvalidHTTPRange = errors.New("http range: invalid http range")
+
+	// MaxHTTPRanges is the maximum number of ranges accepted by
+	// ParseHTTPSpecList in a single header
+	MaxHTTPRanges = 20
 )
 
 // ParseHTTPSpec try to parse HTTP bytes range
@@ -76,6 +81,49 @@ func ParseHTTPSpec(rangeString string) (spec *HTTPRangeSpec, err error) {
 	}
 }
 
+// ParseHTTPSpecList parses a Range header holding one or more comma separated
+// byte ranges, e.g. "bytes=0-10,20-30". Every range must be satisfiable for a
+// resource of the given size, and the ranges must not overlap. At most
+// MaxHTTPRanges ranges are accepted.
+func ParseHTTPSpecList(rangeString string, resourceSize int64) ([]HTTPRangeSpec, error) {
+	if !strings.HasPrefix(rangeString, byteRangePrefix) {
+		return nil, fmt.Errorf("'%s' does not start with '%s'", rangeString, byteRangePrefix)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(rangeString, byteRangePrefix), ",")
+	if len(parts) > MaxHTTPRanges {
+		return nil, fmt.Errorf("'%s' has more than %d ranges", rangeString, MaxHTTPRanges)
+	}
+
+	type offsets struct{ start, end int64 }
+	specs := make([]HTTPRangeSpec, 0, len(parts))
+	spans := make([]offsets, 0, len(parts))
+	for _, part := range parts {
+		spec, err := ParseHTTPSpec(byteRangePrefix + strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		start, length, err := spec.GetOffsetLength(resourceSize)
+		if err != nil {
+			return nil, err
+		}
+		if length <= 0 {
+			return nil, ErrInvalidHTTPRange
+		}
+		specs = append(specs, *spec)
+		spans = append(spans, offsets{start, start + length - 1})
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start <= spans[i-1].end {
+			return nil, fmt.Errorf("'%s' has overlapping ranges", rangeString)
+		}
+	}
+
+	return specs, nil
+}
+
 // HTTPRangeSpec represents a range specification
 //
 // Case 1: Not present -> represented by a nil RangeSpec
@@ -146,3 +194,23 @@ func (h *HTTPRangeSpec) GetOffsetLength(resourceSize int64) (start, length int64
 	}
 	return start, length, nil
 }
+
+// ContentRangeString returns the value of the Content-Range header served for
+// this range, e.g. "bytes 0-9/100", given the size of the resource
+func (h *HTTPRangeSpec) ContentRangeString(resourceSize int64) (string, error) {
+	start, length, err := h.GetOffsetLength(resourceSize)
+	if err != nil {
+		return "", err
+	}
+	if length <= 0 {
+		return "", ErrInvalidHTTPRange
+	}
+
+	return fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, resourceSize), nil
+}
+
+// UnsatisfiedContentRangeString returns the value of the Content-Range header
+// served along a 416 response, e.g. "bytes */100"
+func UnsatisfiedContentRangeString(resourceSize int64) string {
+	return fmt.Sprintf("bytes */%d", resourceSize)
+}
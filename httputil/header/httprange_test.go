@@ -0,0 +1,100 @@
+package header
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHTTPSpecList(t *testing.T) {
+	testCases := []struct {
+		rangeString string
+		size        int64
+		expected    []HTTPRangeSpec
+	}{
+		{"bytes=0-10", 100, []HTTPRangeSpec{{false, 0, 10}}},
+		{"bytes=0-10,20-30", 100, []HTTPRangeSpec{{false, 0, 10}, {false, 20, 30}}},
+		{"bytes=20-30, 0-10", 100, []HTTPRangeSpec{{false, 20, 30}, {false, 0, 10}}},
+		{"bytes=0-10,50-", 100, []HTTPRangeSpec{{false, 0, 10}, {false, 50, -1}}},
+		{"bytes=0-10,-20", 100, []HTTPRangeSpec{{false, 0, 10}, {true, -20, -1}}},
+	}
+
+	for i, testCase := range testCases {
+		specs, err := ParseHTTPSpecList(testCase.rangeString, testCase.size)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(specs, testCase.expected) {
+			t.Errorf("case %d: expected %v, got %v", i+1, testCase.expected, specs)
+		}
+	}
+}
+
+func TestParseHTTPSpecListErrors(t *testing.T) {
+	testCases := []struct {
+		rangeString string
+		size        int64
+	}{
+		{"0-10", 100},
+		{"bytes=", 100},
+		{"bytes=0-10,", 100},
+		{"bytes=0-10,abc", 100},
+		{"bytes=10-5", 100},
+		{"bytes=0-10,200-300", 100},
+		{"bytes=0-10,5-20", 100},
+		{"bytes=0-10,10-20", 100},
+		{"bytes=0-,-10", 100},
+		{"bytes=" + strings.Repeat("0-0,", MaxHTTPRanges) + "0-0", 100},
+	}
+
+	for i, testCase := range testCases {
+		if _, err := ParseHTTPSpecList(testCase.rangeString, testCase.size); err == nil {
+			t.Errorf("case %d: expected an error for %q", i+1, testCase.rangeString)
+		}
+	}
+}
+
+func TestContentRangeString(t *testing.T) {
+	testCases := []struct {
+		spec     *HTTPRangeSpec
+		size     int64
+		expected string
+	}{
+		{nil, 100, "bytes 0-99/100"},
+		{&HTTPRangeSpec{false, 0, 9}, 100, "bytes 0-9/100"},
+		{&HTTPRangeSpec{false, 90, 200}, 100, "bytes 90-99/100"},
+		{&HTTPRangeSpec{false, 50, -1}, 100, "bytes 50-99/100"},
+		{&HTTPRangeSpec{true, -10, -1}, 100, "bytes 90-99/100"},
+		{&HTTPRangeSpec{true, -200, -1}, 100, "bytes 0-99/100"},
+	}
+
+	for i, testCase := range testCases {
+		got, err := testCase.spec.ContentRangeString(testCase.size)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if got != testCase.expected {
+			t.Errorf("case %d: expected %q, got %q", i+1, testCase.expected, got)
+		}
+	}
+
+	invalid := []struct {
+		spec *HTTPRangeSpec
+		size int64
+	}{
+		{&HTTPRangeSpec{false, 100, -1}, 100},
+		{&HTTPRangeSpec{true, -10, -1}, 0},
+		{nil, 0},
+	}
+	for i, testCase := range invalid {
+		if got, err := testCase.spec.ContentRangeString(testCase.size); err == nil {
+			t.Errorf("invalid case %d: expected an error, got %q", i+1, got)
+		}
+	}
+
+	if got := UnsatisfiedContentRangeString(100); got != "bytes */100" {
+		t.Errorf("expected %q, got %q", "bytes */100", got)
+	}
+}
@@ -52,8 +52,8 @@ func Views(pkg string, latencyMeasure *stats.Float64Measure) []*view.View {
 		{
 			Name:        pkg + "/latency",
 			Measure:     latencyMeasure,
-			Description: "Distribution of method latency, by provider and method.",
-			TagKeys:     []tag.Key{ProviderKey, MethodKey},
+			Description: "Distribution of method latency, by provider, method and status.",
+			TagKeys:     []tag.Key{ProviderKey, MethodKey, StatusKey},
 			Aggregation: DefaultMillisecondsDistribution,
 		},
 	}
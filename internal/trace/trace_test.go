@@ -0,0 +1,44 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/thatique/awan/verr"
+	"go.opencensus.io/stats/view"
+)
+
+func TestLatencyViewStatusTag(t *testing.T) {
+	const pkg = "github.com/thatique/awan/internal/trace/test"
+	measure := LatencyMeasure(pkg)
+	views := Views(pkg, measure)
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+
+	tracer := &Tracer{Package: pkg, Provider: "test", LatencyMeasure: measure}
+	ctx := tracer.Start(context.Background(), "Attributes")
+	tracer.End(ctx, verr.New(verr.NotFound, errors.New("missing"), 1, "test"))
+	ctx = tracer.Start(context.Background(), "Attributes")
+	tracer.End(ctx, nil)
+
+	rows, err := view.RetrieveData(pkg + "/latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]bool{}
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == StatusKey {
+				statuses[tag.Value] = true
+			}
+		}
+	}
+	for _, want := range []string{"NotFound", "OK"} {
+		if !statuses[want] {
+			t.Errorf("expected a latency row with status %q, got %v", want, statuses)
+		}
+	}
+}
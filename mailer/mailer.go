@@ -1,8 +1,11 @@
 package mailer
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/mail"
+	"time"
 
 	"github.com/emersion/go-message"
 	"github.com/thatique/awan/internal/trace"
@@ -25,6 +28,9 @@ var (
 type Transport struct {
 	transport driver.Transport
 	tracer    *trace.Tracer
+	limiter   *DomainLimiter
+	attempts  int
+	backoff   time.Duration
 }
 
 // NewTransport initialize transport
@@ -39,21 +45,111 @@ func NewTransport(transport driver.Transport) *Transport {
 	}
 }
 
+// SetDomainLimiter throttles the sends of this transport per recipient domain.
+// It must be called before the transport is used. Pass nil to disable it.
+func (t *Transport) SetDomainLimiter(l *DomainLimiter) {
+	t.limiter = l
+}
+
+// WithRetry returns a Transport sharing t's driver that reissues Send up to
+// attempts times in total when the driver reports a retryable error code, see
+// verr.ErrorCode.Retryable, e.g. SMTP 4xx replies or dropped connections.
+// Permanent failures, like a closed transport, fail right away. It waits
+// backoff before the first retry, doubling it for every following one, and
+// gives up early when ctx would expire before the next attempt.
+//
+// The message is written to memory once before the first attempt, so a
+// retry resends the same bytes even when msg can only be written once.
+func WithRetry(t *Transport, attempts int, backoff time.Duration) *Transport {
+	nt := *t
+	nt.attempts = attempts
+	nt.backoff = backoff
+	return &nt
+}
+
 // Send send email to provided sender and recipient, the `WriterTo` should write
-// well formatted email message.
+// well formatted email message. The addresses may be in the "Name <addr>" form,
+// only the bare address is given to the driver. A malformed address fails with
+// verr.InvalidArgument before anything is sent.
 func (t *Transport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) (err error) {
 	ctx = t.tracer.Start(ctx, "Send")
 	defer func() { t.tracer.End(ctx, err) }()
 
-	err = t.transport.Send(ctx, from, to, msg)
+	if from, err = normalizeAddress(from); err != nil {
+		return err
+	}
+	envelope := make([]string, len(to))
+	for i, addr := range to {
+		if envelope[i], err = normalizeAddress(addr); err != nil {
+			return err
+		}
+	}
+	to = envelope
+
+	if t.limiter != nil {
+		if err = t.limiter.Wait(ctx, to); err != nil {
+			return err
+		}
+	}
+
+	err = t.send(ctx, from, to, msg)
 	if err != nil {
 		err = wrapError(t, err)
 	}
 	return
 }
 
+func (t *Transport) send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	if t.attempts > 1 && msg != nil {
+		var buf bytes.Buffer
+		if err := msg.WriteTo(&buf); err != nil {
+			return err
+		}
+		msg = bufferedMessage(buf.Bytes())
+	}
+
+	backoff := t.backoff
+	for attempt := 1; ; attempt++ {
+		err := t.transport.Send(ctx, from, to, msg)
+		if err == nil || attempt >= t.attempts || !t.transport.ErrorCode(err).Retryable() {
+			return err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// bufferedMessage is a message already written to memory, it can be written
+// any number of times
+type bufferedMessage []byte
+
+func (m bufferedMessage) WriteTo(w io.Writer) error {
+	_, err := w.Write(m)
+	return err
+}
+
+// normalizeAddress returns the bare address of addr
+func normalizeAddress(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", verr.Newf(verr.InvalidArgument, err, "mailer: invalid address %q", addr)
+	}
+	return parsed.Address, nil
+}
+
 // SendMessage send `message.Entity`, the sender and recipients is taken from the
-// message entity
+// message entity. Bcc recipients receive the message but the Bcc header itself
+// is not sent.
 func (t *Transport) SendMessage(ctx context.Context, msg *message.Entity) (err error) {
 	ctx = t.tracer.Start(ctx, "SendMessage")
 	defer func() { t.tracer.End(ctx, err) }()
@@ -94,7 +190,25 @@ func (t *Transport) SendMessage(ctx context.Context, msg *message.Entity) (err e
 		}
 	}
 
-	return t.Send(ctx, fromAddrs[0].Address, toAddrs, msg)
+	return t.Send(ctx, fromAddrs[0].Address, toAddrs, withoutBcc(msg, headerPrefix+"Bcc"))
+}
+
+// withoutBcc returns a shallow copy of msg whose header doesn't reveal the
+// blind recipients
+func withoutBcc(msg *message.Entity, key string) *message.Entity {
+	if msg.Header.Get(key) == "" {
+		return msg
+	}
+
+	header := make(message.Header, len(msg.Header))
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header.Del(key)
+
+	stripped := *msg
+	stripped.Header = header
+	return &stripped
 }
 
 // Close the connection
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatique/awan/mailer/driver"
+	"github.com/thatique/awan/verr"
+)
+
+func TestSendNormalizesAddresses(t *testing.T) {
+	ft := &fakeTransport{}
+	tr := NewTransport(ft)
+
+	err := tr.Send(context.Background(), `"Me" <me@example.com>`, []string{"Alice <alice@example.com>", "bob@example.org"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.sent) != 1 || strings.Join(ft.sent[0], ",") != "alice@example.com,bob@example.org" {
+		t.Errorf("expected bare recipient addresses, got %v", ft.sent)
+	}
+}
+
+func TestSendRejectsMalformedAddresses(t *testing.T) {
+	testCases := []struct {
+		from string
+		to   []string
+	}{
+		{"not an address", []string{"to@example.com"}},
+		{"me@example.com", []string{"to@example.com", "missing-at-sign"}},
+		{"me@example.com", []string{"Alice <alice@example.com"}},
+		{"", []string{"to@example.com"}},
+	}
+
+	for i, testCase := range testCases {
+		ft := &fakeTransport{}
+		err := NewTransport(ft).Send(context.Background(), testCase.from, testCase.to, nil)
+		if code := verr.Code(err); code != verr.InvalidArgument {
+			t.Errorf("case %d: expected InvalidArgument, got %v (%v)", i+1, code, err)
+		}
+		if len(ft.sent) != 0 {
+			t.Errorf("case %d: expected nothing to be sent", i+1)
+		}
+	}
+}
+
+// failingTransport fails every Send with err, reported as code
+type failingTransport struct {
+	fakeTransport
+	err   error
+	code  verr.ErrorCode
+	calls int
+}
+
+func (f *failingTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	f.calls++
+	return f.err
+}
+
+func (f *failingTransport) ErrorCode(err error) verr.ErrorCode {
+	return f.code
+}
+
+func TestRetryOnlyRetryableCodes(t *testing.T) {
+	testCases := []struct {
+		code  verr.ErrorCode
+		calls int
+	}{
+		// e.g. the closed transport errors of the drivers
+		{verr.FailedPrecondition, 1},
+		{verr.InvalidArgument, 1},
+		{verr.Unavailable, 3},
+	}
+
+	for _, testCase := range testCases {
+		ft := &failingTransport{err: errors.New("failed"), code: testCase.code}
+		tr := WithRetry(NewTransport(ft), 3, time.Millisecond)
+		if err := tr.Send(context.Background(), "me@example.com", []string{"to@example.com"}, nil); err == nil {
+			t.Errorf("%v: expected an error", testCase.code)
+		}
+		if ft.calls != testCase.calls {
+			t.Errorf("%v: expected %d attempts, got %d", testCase.code, testCase.calls, ft.calls)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/mail"
+	"time"
+
+	"github.com/emersion/go-message"
+)
+
+var (
+	// ErrNoSender returned by Message.Entity when the message has no From
+	ErrNoSender = errors.New("mailer: message has no sender")
+
+	// ErrNoRecipient returned by Message.Entity when the message has no To, Cc
+	// or Bcc recipient
+	ErrNoRecipient = errors.New("mailer: message has no recipient")
+)
+
+type attachment struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// Message builds a well formed MIME message, to be sent with
+// Transport.SendMessage. The text and HTML bodies are sent as
+// multipart/alternative when both are set, and wrapped in multipart/mixed
+// along the attachments if there are any.
+type Message struct {
+	from        *mail.Address
+	to, cc, bcc []*mail.Address
+	subject     string
+	text, html  string
+	attachments []attachment
+}
+
+// NewMessage returns an empty Message
+func NewMessage() *Message {
+	return &Message{}
+}
+
+// SetFrom sets the sender of the message
+func (m *Message) SetFrom(addr *mail.Address) *Message {
+	m.from = addr
+	return m
+}
+
+// AddTo adds recipients to the To header
+func (m *Message) AddTo(addrs ...*mail.Address) *Message {
+	m.to = append(m.to, addrs...)
+	return m
+}
+
+// AddCc adds recipients to the Cc header
+func (m *Message) AddCc(addrs ...*mail.Address) *Message {
+	m.cc = append(m.cc, addrs...)
+	return m
+}
+
+// AddBcc adds blind recipients, SendMessage delivers to them without sending
+// the Bcc header
+func (m *Message) AddBcc(addrs ...*mail.Address) *Message {
+	m.bcc = append(m.bcc, addrs...)
+	return m
+}
+
+// SetSubject sets the subject of the message
+func (m *Message) SetSubject(subject string) *Message {
+	m.subject = subject
+	return m
+}
+
+// SetText sets the plain text body
+func (m *Message) SetText(body string) *Message {
+	m.text = body
+	return m
+}
+
+// SetHTML sets the HTML body
+func (m *Message) SetHTML(body string) *Message {
+	m.html = body
+	return m
+}
+
+// AddAttachment attaches data as filename. contentType defaults to
+// application/octet-stream when empty.
+func (m *Message) AddAttachment(filename, contentType string, data []byte) *Message {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	m.attachments = append(m.attachments, attachment{filename: filename, contentType: contentType, data: data})
+	return m
+}
+
+// Entity returns the message as a *message.Entity. The entity's body can only
+// be read once, call Entity again to send the message another time.
+func (m *Message) Entity() (*message.Entity, error) {
+	if m.from == nil {
+		return nil, ErrNoSender
+	}
+	if len(m.to)+len(m.cc)+len(m.bcc) == 0 {
+		return nil, ErrNoRecipient
+	}
+
+	body, err := m.bodyEntity()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.attachments) > 0 {
+		parts := []*message.Entity{body}
+		for _, a := range m.attachments {
+			h := make(message.Header)
+			h.SetContentType(a.contentType, map[string]string{"name": a.filename})
+			h.SetContentDisposition("attachment", map[string]string{"filename": a.filename})
+			part, err := newEntity(h, "base64", a.data)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		h := make(message.Header)
+		h.SetContentType("multipart/mixed", map[string]string{})
+		if body, err = message.NewMultipart(h, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	h := body.Header
+	h.Set("MIME-Version", "1.0")
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("From", m.from.String())
+	for key, addrs := range map[string][]*mail.Address{"To": m.to, "Cc": m.cc, "Bcc": m.bcc} {
+		if len(addrs) > 0 {
+			h.Set(key, FormatAdressList(addrs))
+		}
+	}
+	if m.subject != "" {
+		h.Set("Subject", mime.QEncoding.Encode("utf-8", m.subject))
+	}
+
+	return body, nil
+}
+
+// bodyEntity returns the text and HTML bodies, as multipart/alternative if
+// both are set
+func (m *Message) bodyEntity() (*message.Entity, error) {
+	var parts []*message.Entity
+	for _, b := range []struct{ contentType, body string }{{"text/plain", m.text}, {"text/html", m.html}} {
+		if b.body == "" {
+			continue
+		}
+		h := make(message.Header)
+		h.SetContentType(b.contentType, map[string]string{"charset": "utf-8"})
+		part, err := newEntity(h, "quoted-printable", []byte(b.body))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	switch len(parts) {
+	case 0:
+		h := make(message.Header)
+		h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+		return newEntity(h, "7bit", nil)
+	case 1:
+		return parts[0], nil
+	}
+
+	h := make(message.Header)
+	h.SetContentType("multipart/alternative", map[string]string{})
+	return message.NewMultipart(h, parts)
+}
+
+// newEntity returns an entity with the given decoded body, encoded with
+// encoding when written
+func newEntity(h message.Header, encoding string, body []byte) (*message.Entity, error) {
+	// message.New decodes the body according to the header, so the transfer
+	// encoding is only set once the entity is created
+	e, err := message.New(h, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	e.Header.Set("Content-Transfer-Encoding", encoding)
+	return e, nil
+}
@@ -0,0 +1,177 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+)
+
+func TestMessageEntity(t *testing.T) {
+	attachment := []byte("\x00\x01binary attachment\xff")
+	msg := NewMessage().
+		SetFrom(&mail.Address{Name: "Sender", Address: "sender@example.com"}).
+		AddTo(&mail.Address{Address: "to@example.com"}).
+		AddCc(&mail.Address{Address: "cc@example.com"}).
+		AddBcc(&mail.Address{Address: "bcc@example.com"}).
+		SetSubject("Héllo").
+		SetText("Hello, world").
+		SetHTML("<p>Hello, world</p>").
+		AddAttachment("report.bin", "", attachment)
+
+	e := mustWriteAndRead(t, msg)
+	if got := e.Header.Get("From"); got != `"Sender" <sender@example.com>` {
+		t.Errorf("unexpected From %q", got)
+	}
+	for key, want := range map[string]string{"To": "<to@example.com>", "Cc": "<cc@example.com>", "Bcc": "<bcc@example.com>", "MIME-Version": "1.0"} {
+		if got := e.Header.Get(key); got != want {
+			t.Errorf("expected %s %q, got %q", key, want, got)
+		}
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(e.Header.Get("Subject")); err != nil || subject != "Héllo" {
+		t.Errorf("unexpected Subject %q: %v", subject, err)
+	}
+
+	parts := readParts(t, e, "multipart/mixed")
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+
+	alternatives := readParts(t, parts[0], "multipart/alternative")
+	if len(alternatives) != 2 {
+		t.Fatalf("expected 2 alternatives, got %d", len(alternatives))
+	}
+	checkPart(t, alternatives[0], "text/plain", "Hello, world")
+	checkPart(t, alternatives[1], "text/html", "<p>Hello, world</p>")
+
+	if disp, params, _ := parts[1].Header.ContentDisposition(); disp != "attachment" || params["filename"] != "report.bin" {
+		t.Errorf("unexpected attachment disposition %q %v", disp, params)
+	}
+	if enc := parts[1].Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+		t.Errorf("expected base64 attachment, got %q", enc)
+	}
+	checkPart(t, parts[1], "application/octet-stream", string(attachment))
+}
+
+func TestSendMessageStripsBcc(t *testing.T) {
+	e, err := NewMessage().
+		SetFrom(&mail.Address{Address: "sender@example.com"}).
+		AddTo(&mail.Address{Address: "to@example.com"}).
+		AddBcc(&mail.Address{Address: "hidden@example.com"}).
+		SetText("Hello, world").
+		Entity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ft := &fakeTransport{}
+	if err = NewTransport(ft).SendMessage(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ft.sent) != 1 || strings.Join(ft.sent[0], ",") != "to@example.com,hidden@example.com" {
+		t.Fatalf("unexpected recipients %v", ft.sent)
+	}
+	sent, err := message.Read(bytes.NewReader(ft.messages[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sent.Header.Get("Bcc"); got != "" {
+		t.Errorf("expected no Bcc header in the sent message, got %q", got)
+	}
+	if bytes.Contains(ft.messages[0], []byte("hidden@example.com")) {
+		t.Errorf("sent message leaks the Bcc recipient:\n%s", ft.messages[0])
+	}
+	if got := e.Header.Get("Bcc"); got == "" {
+		t.Error("expected the caller's entity to keep its Bcc header")
+	}
+}
+
+func TestMessageEntitySinglePart(t *testing.T) {
+	msg := NewMessage().
+		SetFrom(&mail.Address{Address: "sender@example.com"}).
+		AddTo(&mail.Address{Address: "to@example.com"}).
+		SetText("Hello, world")
+
+	e := mustWriteAndRead(t, msg)
+	checkPart(t, e, "text/plain", "Hello, world")
+	if got := e.Header.Get("Cc"); got != "" {
+		t.Errorf("expected no Cc header, got %q", got)
+	}
+}
+
+func TestMessageEntityErrors(t *testing.T) {
+	if _, err := NewMessage().AddTo(&mail.Address{Address: "to@example.com"}).Entity(); err != ErrNoSender {
+		t.Errorf("expected %v, got %v", ErrNoSender, err)
+	}
+	if _, err := NewMessage().SetFrom(&mail.Address{Address: "sender@example.com"}).Entity(); err != ErrNoRecipient {
+		t.Errorf("expected %v, got %v", ErrNoRecipient, err)
+	}
+}
+
+func mustWriteAndRead(t *testing.T, msg *Message) *message.Entity {
+	t.Helper()
+	e, err := msg.Entity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = e.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = message.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func readParts(t *testing.T, e *message.Entity, mediaType string) []*message.Entity {
+	t.Helper()
+	if got, _, _ := e.Header.ContentType(); got != mediaType {
+		t.Fatalf("expected %s, got %s", mediaType, got)
+	}
+	mr := e.MultipartReader()
+	var parts []*message.Entity
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the next part invalidates this one's body, keep a copy
+		body, err := ioutil.ReadAll(p.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Body = bytes.NewReader(body)
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "multipart/") {
+			if p, err = message.New(p.Header, bytes.NewReader(body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+func checkPart(t *testing.T, e *message.Entity, mediaType, body string) {
+	t.Helper()
+	if got, _, _ := e.Header.ContentType(); got != mediaType {
+		t.Errorf("expected %s, got %s", mediaType, got)
+	}
+	b, err := ioutil.ReadAll(e.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != body {
+		t.Errorf("expected %s body %q, got %q", mediaType, body, b)
+	}
+}
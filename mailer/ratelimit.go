@@ -0,0 +1,133 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DomainLimiter throttles sending per recipient domain, so a burst of mails to
+// one provider is smoothed out while mails to other domains proceed.
+type DomainLimiter struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	intervals map[string]time.Duration
+	next      map[string]time.Time
+}
+
+// NewDomainLimiter returns a DomainLimiter allowing rps messages per second to
+// each recipient domain. A zero or negative rps means no limit.
+func NewDomainLimiter(rps float64) *DomainLimiter {
+	return &DomainLimiter{
+		interval:  rpsInterval(rps),
+		intervals: make(map[string]time.Duration),
+		next:      make(map[string]time.Time),
+	}
+}
+
+// SetLimit overrides the limit for the given domain.
+func (l *DomainLimiter) SetLimit(domain string, rps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.intervals[strings.ToLower(domain)] = rpsInterval(rps)
+}
+
+// Wait blocks until a message may be sent to all the given recipients, or ctx
+// is done. When ctx is done first the slots reserved for the domains are given
+// back, unless later calls reserved slots after them.
+func (l *DomainLimiter) Wait(ctx context.Context, to []string) error {
+	var delay time.Duration
+
+	l.mu.Lock()
+	now := time.Now()
+	reserved := make(map[string]reservation, len(to))
+	for _, addr := range to {
+		domain := addressDomain(addr)
+		if _, ok := reserved[domain]; ok {
+			continue
+		}
+
+		r := l.reserve(domain, now)
+		reserved[domain] = r
+		if d := r.slot.Sub(now); d > delay {
+			delay = d
+		}
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.release(reserved)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reservation is a slot reserved for a domain, with the next slot of the
+// domain before and after it was reserved. next is zero for unlimited domains.
+type reservation struct {
+	slot     time.Time
+	prevNext time.Time
+	next     time.Time
+}
+
+// reserve the next slot of the domain. The caller must hold l.mu.
+func (l *DomainLimiter) reserve(domain string, now time.Time) reservation {
+	interval, ok := l.intervals[domain]
+	if !ok {
+		interval = l.interval
+	}
+	prevNext := l.next[domain]
+	if interval <= 0 {
+		return reservation{slot: now, prevNext: prevNext}
+	}
+
+	slot := prevNext
+	if slot.Before(now) {
+		slot = now
+	}
+	next := slot.Add(interval)
+	l.next[domain] = next
+
+	return reservation{slot: slot, prevNext: prevNext, next: next}
+}
+
+// release gives back the reserved slots still being the last of their domain
+func (l *DomainLimiter) release(reserved map[string]reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for domain, r := range reserved {
+		if r.next.IsZero() || !l.next[domain].Equal(r.next) {
+			continue
+		}
+		if r.prevNext.IsZero() {
+			delete(l.next, domain)
+		} else {
+			l.next[domain] = r.prevNext
+		}
+	}
+}
+
+func rpsInterval(rps float64) time.Duration {
+	if rps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rps)
+}
+
+func addressDomain(addr string) string {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		addr = addr[i+1:]
+	}
+	return strings.ToLower(strings.TrimSuffix(addr, ">"))
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thatique/awan/mailer/driver"
+	"github.com/thatique/awan/verr"
+)
+
+// fakeTransport is a driver.Transport recording the recipients it sends to
+// and the messages written
+type fakeTransport struct {
+	mu       sync.Mutex
+	sent     [][]string
+	messages [][]byte
+}
+
+func (f *fakeTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, to)
+	if msg != nil {
+		var buf bytes.Buffer
+		if err := msg.WriteTo(&buf); err != nil {
+			return err
+		}
+		f.messages = append(f.messages, buf.Bytes())
+	}
+	return nil
+}
+
+func (f *fakeTransport) Close() error {
+	return nil
+}
+
+func (f *fakeTransport) ErrorCode(err error) verr.ErrorCode {
+	return verr.Unknown
+}
+
+func TestDomainLimiter(t *testing.T) {
+	ctx := context.Background()
+	ft := &fakeTransport{}
+	tr := NewTransport(ft)
+	tr.SetDomainLimiter(NewDomainLimiter(20)) // one mail every 50ms per domain
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := tr.Send(ctx, "me@example.com", []string{"a@gmail.com"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected sends to gmail.com to be throttled, took %v", elapsed)
+	}
+
+	// Another domain is not held back by the gmail.com sends.
+	start = time.Now()
+	if err := tr.Send(ctx, "me@example.com", []string{"b@example.org"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Millisecond {
+		t.Errorf("expected send to example.org not to be throttled, took %v", elapsed)
+	}
+	if len(ft.sent) != 4 {
+		t.Errorf("expected 4 sends, got %d", len(ft.sent))
+	}
+}
+
+func TestDomainLimiterOverride(t *testing.T) {
+	l := NewDomainLimiter(0)
+	l.SetLimit("Slow.example", 1)
+
+	ctx := context.Background()
+	if err := l.Wait(ctx, []string{"a@fast.example", "b@slow.example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, []string{"c@fast.example"}); err != nil {
+		t.Errorf("unlimited domain should not wait, got %v", err)
+	}
+	if err := l.Wait(ctx, []string{"d@SLOW.example"}); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded for throttled domain, got %v", err)
+	}
+}
+
+func TestDomainLimiterReleasesCanceledWait(t *testing.T) {
+	l := NewDomainLimiter(5) // one mail every 200ms per domain
+	to := []string{"a@one.example", "b@two.example"}
+
+	ctx := context.Background()
+	if err := l.Wait(ctx, to); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(canceled, to); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// the canceled wait gave its slots back, so the next send only waits for
+	// the slots after the first one
+	start := time.Now()
+	if err := l.Wait(ctx, to); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("expected the canceled slots to be released, waited %v", elapsed)
+	}
+}
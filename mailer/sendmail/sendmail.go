@@ -0,0 +1,173 @@
+// Package sendmail provides a mailer transport handing messages to a local
+// sendmail compatible binary.
+package sendmail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/thatique/awan/mailer"
+	"github.com/thatique/awan/mailer/driver"
+	"github.com/thatique/awan/verr"
+)
+
+var (
+	// ErrAlreadyClosed returned when sending with a closed transport
+	ErrAlreadyClosed = errors.New("mailer.sendmail: already closed")
+)
+
+const (
+	// Scheme is constant for our scheme when using URL opener
+	Scheme = "sendmail"
+
+	// DefaultPath is the sendmail binary used when none is configured
+	DefaultPath = "/usr/sbin/sendmail"
+)
+
+func init() {
+	mailer.DefaultURLMux().RegisterTransport(Scheme, new(URLOpener))
+}
+
+// URLOpener opens Mailer URLs like sendmail:///usr/sbin/sendmail. The path is
+// the binary to run, DefaultPath is used when it's empty.
+type URLOpener struct{}
+
+// OpenTransportURL open `mailer.Transport`
+func (uo *URLOpener) OpenTransportURL(ctx context.Context, u *url.URL) (*mailer.Transport, error) {
+	return NewTransport(&Options{Path: u.Path})
+}
+
+// Options for running the sendmail binary
+type Options struct {
+	// Path of the sendmail binary. Default to DefaultPath.
+	Path string
+	// Args are extra arguments passed before the sender and recipients.
+	Args []string
+}
+
+// ExitError is returned when the sendmail binary exits with a non-zero status
+type ExitError struct {
+	// Code is the exit status, usually one of the sysexits.h codes
+	Code int
+	// Stderr is what the binary printed on its standard error
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("mailer.sendmail: exit status %d", e.Code)
+	}
+	return fmt.Sprintf("mailer.sendmail: exit status %d: %s", e.Code, e.Stderr)
+}
+
+// NewTransport create new instance of `mailer.Transport` piping messages to
+// the sendmail binary
+func NewTransport(options *Options) (*mailer.Transport, error) {
+	return mailer.NewTransport(newSendmailTransport(options)), nil
+}
+
+type sendmailTransport struct {
+	mu     sync.Mutex
+	closed bool
+	option *Options
+}
+
+func newSendmailTransport(option *Options) *sendmailTransport {
+	opt := *option
+	if opt.Path == "" {
+		opt.Path = DefaultPath
+	}
+	return &sendmailTransport{option: &opt}
+}
+
+// Send runs the sendmail binary with the message on its standard input. The
+// process is killed if ctx is done before it exits.
+func (t *sendmailTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return ErrAlreadyClosed
+	}
+
+	args := append([]string{}, t.option.Args...)
+	args = append(args, "-i", "-f", from, "--")
+	args = append(args, to...)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.option.Path, args...)
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	werr := msg.WriteTo(stdin)
+	if cerr := stdin.Close(); werr == nil {
+		werr = cerr
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &ExitError{Code: exitErr.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+	}
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// Close the transport, there is no connection to release.
+func (t *sendmailTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+// ErrorCode maps the sysexits.h exit codes of sendmail to verr codes.
+func (t *sendmailTransport) ErrorCode(err error) verr.ErrorCode {
+	if err == nil {
+		return verr.OK
+	}
+	if err == ErrAlreadyClosed {
+		return verr.FailedPrecondition
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+		return verr.FailedPrecondition
+	}
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return verr.Unknown
+	}
+	switch exitErr.Code {
+	case 64, 65: // EX_USAGE, EX_DATAERR
+		return verr.InvalidArgument
+	case 66, 67, 68: // EX_NOINPUT, EX_NOUSER, EX_NOHOST
+		return verr.NotFound
+	case 69, 75: // EX_UNAVAILABLE, EX_TEMPFAIL
+		return verr.Unavailable
+	case 70, 71, 72, 73, 74, 76: // EX_SOFTWARE, EX_OSERR, EX_OSFILE, EX_CANTCREAT, EX_IOERR, EX_PROTOCOL
+		return verr.Internal
+	case 77: // EX_NOPERM
+		return verr.PermissionDenied
+	case 78: // EX_CONFIG
+		return verr.FailedPrecondition
+	default:
+		return verr.Unknown
+	}
+}
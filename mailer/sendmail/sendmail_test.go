@@ -0,0 +1,120 @@
+package sendmail
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/thatique/awan/mailer"
+	"github.com/thatique/awan/verr"
+)
+
+// fakeSendmail writes a script recording its arguments and standard input
+// next to itself, then running the given tail.
+func fakeSendmail(t *testing.T, tail string) (string, func()) {
+	dir, err := ioutil.TempDir("", "sendmail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "sendmail")
+	script := "#!/bin/sh\necho \"$@\" > \"$0.args\"\ncat > \"$0.stdin\"\n" + tail + "\n"
+	if err = ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return path, cleanup
+}
+
+func newMessage(t *testing.T, body string) *message.Entity {
+	h := make(message.Header)
+	h.Set("Subject", "test")
+	msg, err := message.New(h, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestSend(t *testing.T) {
+	path, cleanup := fakeSendmail(t, "exit 0")
+	defer cleanup()
+	tr, err := mailer.OpenTransport(context.Background(), "sendmail://"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	err = tr.Send(context.Background(), "from@example.com", []string{"a@example.com", "b@example.org"}, newMessage(t, "hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, _ := ioutil.ReadFile(path + ".args")
+	if got, want := strings.TrimSpace(string(args)), "-i -f from@example.com -- a@example.com b@example.org"; got != want {
+		t.Errorf("got args %q, want %q", got, want)
+	}
+	stdin, _ := ioutil.ReadFile(path + ".stdin")
+	if !strings.Contains(string(stdin), "Subject: test") || !strings.Contains(string(stdin), "hello world") {
+		t.Errorf("message not piped to stdin, got %q", stdin)
+	}
+}
+
+func TestSendExitCode(t *testing.T) {
+	path, cleanup := fakeSendmail(t, "echo 'no such user' >&2; exit 67")
+	defer cleanup()
+	tr, _ := NewTransport(&Options{Path: path})
+	defer tr.Close()
+
+	err := tr.Send(context.Background(), "from@example.com", []string{"nobody@example.com"}, newMessage(t, "hello"))
+	if verr.Code(err) != verr.NotFound {
+		t.Errorf("expected NotFound, got %v (%v)", verr.Code(err), err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Errorf("expected stderr in the error, got %v", err)
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	path, cleanup := fakeSendmail(t, "exec sleep 10")
+	defer cleanup()
+	tr, _ := NewTransport(&Options{Path: path})
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := tr.Send(ctx, "from@example.com", []string{"to@example.com"}, newMessage(t, "hello"))
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sendmail was not killed, Send took %v", elapsed)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tr := newSendmailTransport(&Options{})
+	tests := []struct {
+		err  error
+		want verr.ErrorCode
+	}{
+		{nil, verr.OK},
+		{ErrAlreadyClosed, verr.FailedPrecondition},
+		{&ExitError{Code: 64}, verr.InvalidArgument},
+		{&ExitError{Code: 75}, verr.Unavailable},
+		{&ExitError{Code: 77}, verr.PermissionDenied},
+		{&ExitError{Code: 1}, verr.Unknown},
+	}
+	for _, test := range tests {
+		if got := tr.ErrorCode(test.err); got != test.want {
+			t.Errorf("ErrorCode(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
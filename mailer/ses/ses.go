@@ -0,0 +1,263 @@
+// Package ses provides a mailer transport sending messages with the Amazon
+// SES SendRawEmail API.
+package ses
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/thatique/awan/mailer"
+	"github.com/thatique/awan/mailer/driver"
+	"github.com/thatique/awan/verr"
+)
+
+var (
+	// ErrAlreadyClosed returned when sending with a closed transport
+	ErrAlreadyClosed = errors.New("mailer.ses: already closed")
+
+	// ErrNoRegion returned by NewTransport when neither Options.Region nor
+	// the AWS_REGION environment variable is set
+	ErrNoRegion = errors.New("mailer.ses: no region")
+)
+
+// Scheme is constant for our scheme when using URL opener, it is also the
+// name of the verr registry holding the SES error codes.
+const Scheme = "ses"
+
+const apiVersion = "2010-12-01"
+
+func init() {
+	mailer.DefaultURLMux().RegisterTransport(Scheme, new(URLOpener))
+
+	verr.RegisterProviderCodes(Scheme, map[string]verr.ErrorCode{
+		"Throttling":                             verr.ResourceExhausted,
+		"MessageRejected":                        verr.InvalidArgument,
+		"InvalidParameterValue":                  verr.InvalidArgument,
+		"InvalidParameterCombination":            verr.InvalidArgument,
+		"MissingParameter":                       verr.InvalidArgument,
+		"MailFromDomainNotVerifiedException":     verr.FailedPrecondition,
+		"AccountSendingPausedException":          verr.FailedPrecondition,
+		"ConfigurationSetSendingPausedException": verr.FailedPrecondition,
+		"ConfigurationSetDoesNotExistException":  verr.NotFound,
+		"AccessDenied":                           verr.PermissionDenied,
+		"IncompleteSignature":                    verr.Unauthenticated,
+		"InvalidClientTokenId":                   verr.Unauthenticated,
+		"MissingAuthenticationToken":             verr.Unauthenticated,
+		"SignatureDoesNotMatch":                  verr.Unauthenticated,
+		"ExpiredToken":                           verr.Unauthenticated,
+		"InternalFailure":                        verr.Internal,
+		"ServiceUnavailable":                     verr.Unavailable,
+	})
+}
+
+// URLOpener opens Mailer URLs like
+// ses://accesskey:secretkey@?region=us-east-1
+//
+// The credentials are read from the environment or the shared credentials
+// file when the URL has none. The following query parameters are supported:
+//   - region: the AWS region, defaults to the AWS_REGION environment variable.
+//   - endpoint: the URL of the SES API, defaults to the regional endpoint.
+type URLOpener struct{}
+
+// OpenTransportURL open `mailer.Transport`
+func (uo *URLOpener) OpenTransportURL(ctx context.Context, u *url.URL) (*mailer.Transport, error) {
+	options := &Options{}
+	for param, values := range u.Query() {
+		switch param {
+		case "region":
+			options.Region = values[0]
+		case "endpoint":
+			options.Endpoint = values[0]
+		default:
+			return nil, fmt.Errorf("mailer.ses: unknown query parameter %q", param)
+		}
+	}
+	if u.User != nil {
+		secret, _ := u.User.Password()
+		options.Credentials = credentials.NewStaticV4(u.User.Username(), secret, "")
+	}
+	return NewTransport(options)
+}
+
+// Options for sending with SES
+type Options struct {
+	// Region of the SES API. Default to the AWS_REGION environment variable.
+	Region string
+	// Endpoint is the URL of the SES API. Default to
+	// https://email.<region>.amazonaws.com.
+	Endpoint string
+	// Credentials used to sign the requests. Default to the AWS environment
+	// variables, then to the shared credentials file.
+	Credentials *credentials.Credentials
+	// HTTPClient sends the requests. Default to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Error is returned when the SES API answers with an error
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mailer.ses: %s: %s (status %d, request id %s)", e.Code, e.Message, e.StatusCode, e.RequestID)
+}
+
+// NewTransport create new instance of `mailer.Transport` sending messages
+// with SES
+func NewTransport(options *Options) (*mailer.Transport, error) {
+	t, err := newSESTransport(options)
+	if err != nil {
+		return nil, err
+	}
+	return mailer.NewTransport(t), nil
+}
+
+type sesTransport struct {
+	mu     sync.Mutex
+	closed bool
+	option *Options
+}
+
+func newSESTransport(option *Options) (*sesTransport, error) {
+	opt := *option
+	if opt.Region == "" {
+		opt.Region = os.Getenv("AWS_REGION")
+	}
+	if opt.Region == "" {
+		return nil, ErrNoRegion
+	}
+	if opt.Endpoint == "" {
+		opt.Endpoint = "https://email." + opt.Region + ".amazonaws.com"
+	}
+	if _, err := url.Parse(opt.Endpoint); err != nil {
+		return nil, err
+	}
+	if opt.Credentials == nil {
+		opt.Credentials = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+		})
+	}
+	if opt.HTTPClient == nil {
+		opt.HTTPClient = http.DefaultClient
+	}
+	return &sesTransport{option: &opt}, nil
+}
+
+// Send the message with SendRawEmail. The recipients are passed as the
+// destinations, so Bcc recipients are delivered as well.
+func (t *sesTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return ErrAlreadyClosed
+	}
+
+	var raw bytes.Buffer
+	if err := msg.WriteTo(&raw); err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("Action", "SendRawEmail")
+	form.Set("Version", apiVersion)
+	form.Set("Source", from)
+	for i, addr := range to {
+		form.Set("Destinations.member."+strconv.Itoa(i+1), addr)
+	}
+	form.Set("RawMessage.Data", base64.StdEncoding.EncodeToString(raw.Bytes()))
+	body := []byte(form.Encode())
+
+	creds, err := t.option.Credentials.Get()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.option.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, body, creds, Scheme, t.option.Region, time.Now())
+
+	resp, err := t.option.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return parseError(resp)
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
+// parseError reads the ErrorResponse document of a failed request
+func parseError(resp *http.Response) error {
+	var doc struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+		RequestID string `xml:"RequestId"`
+	}
+	e := &Error{StatusCode: resp.StatusCode}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil && xml.Unmarshal(data, &doc) == nil {
+		e.Code, e.Message, e.RequestID = doc.Error.Code, doc.Error.Message, doc.RequestID
+	}
+	if e.Code == "" {
+		e.Code = strings.Replace(http.StatusText(resp.StatusCode), " ", "", -1)
+	}
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
+// Close the transport, there is no connection to release.
+func (t *sesTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+// ErrorCode maps the SES error codes to verr codes, falling back to the HTTP
+// status for unknown codes.
+func (t *sesTransport) ErrorCode(err error) verr.ErrorCode {
+	if err == nil {
+		return verr.OK
+	}
+	if err == ErrAlreadyClosed {
+		return verr.FailedPrecondition
+	}
+
+	var sesErr *Error
+	if !errors.As(err, &sesErr) {
+		return verr.Unknown
+	}
+	if code := verr.FromProviderCode(Scheme, sesErr.Code); code != verr.Unknown {
+		return code
+	}
+	return verr.FromHTTPStatus(sesErr.StatusCode)
+}
@@ -0,0 +1,135 @@
+package ses
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/thatique/awan/mailer"
+	"github.com/thatique/awan/verr"
+)
+
+func newMessage(t *testing.T, body string) *message.Entity {
+	h := make(message.Header)
+	h.Set("Subject", "test")
+	msg, err := message.New(h, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func openTransport(t *testing.T, endpoint string) *mailer.Transport {
+	tr, err := mailer.OpenTransport(context.Background(),
+		"ses://AKID:SECRET@?region=us-east-1&endpoint="+url.QueryEscape(endpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestSend(t *testing.T) {
+	var form url.Values
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		form = r.PostForm
+		w.Write([]byte(`<SendRawEmailResponse><SendRawEmailResult><MessageId>id</MessageId></SendRawEmailResult></SendRawEmailResponse>`))
+	}))
+	defer srv.Close()
+
+	tr := openTransport(t, srv.URL)
+	defer tr.Close()
+
+	err := tr.Send(context.Background(), "from@example.com", []string{"a@example.com", "b@example.org"}, newMessage(t, "hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"Action":                "SendRawEmail",
+		"Source":                "from@example.com",
+		"Destinations.member.1": "a@example.com",
+		"Destinations.member.2": "b@example.org",
+	} {
+		if got := form.Get(key); got != want {
+			t.Errorf("expected %s %q, got %q", key, want, got)
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(form.Get("RawMessage.Data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "Subject: test") || !strings.Contains(string(raw), "hello world") {
+		t.Errorf("raw message not transmitted, got %q", raw)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/ses/aws4_request") {
+		t.Errorf("unexpected Authorization %q", auth)
+	}
+}
+
+func TestSendErrorCode(t *testing.T) {
+	testCases := []struct {
+		status int
+		body   string
+		code   verr.ErrorCode
+	}{
+		{http.StatusBadRequest, "Throttling", verr.ResourceExhausted},
+		{http.StatusBadRequest, "MessageRejected", verr.InvalidArgument},
+		{http.StatusBadRequest, "InvalidParameterValue", verr.InvalidArgument},
+		{http.StatusForbidden, "SignatureDoesNotMatch", verr.Unauthenticated},
+		{http.StatusServiceUnavailable, "", verr.Unavailable},
+	}
+
+	for _, testCase := range testCases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(testCase.status)
+			if testCase.body != "" {
+				w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>` + testCase.body +
+					`</Code><Message>failed</Message></Error><RequestId>req</RequestId></ErrorResponse>`))
+			}
+		}))
+		tr := openTransport(t, srv.URL)
+
+		err := tr.Send(context.Background(), "from@example.com", []string{"a@example.com"}, newMessage(t, "hello"))
+		if got := verr.Code(err); got != testCase.code {
+			t.Errorf("%d %s: expected %v, got %v (%v)", testCase.status, testCase.body, testCase.code, got, err)
+		}
+		tr.Close()
+		srv.Close()
+	}
+}
+
+func TestOpenTransportURL(t *testing.T) {
+	ctx := context.Background()
+	if _, err := mailer.OpenTransport(ctx, "ses://?region=us-east-1&foo=bar"); err == nil {
+		t.Error("expected an error for an unknown query parameter")
+	}
+	if _, err := NewTransport(&Options{Region: "eu-west-1"}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSignV4 checks the signer against the get-vanilla case of the AWS
+// Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds, _ := credentials.NewStaticV4("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "").Get()
+	signV4(req, nil, creds, "service", "us-east-1", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
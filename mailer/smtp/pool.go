@@ -0,0 +1,89 @@
+package smtp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thatique/awan/mailer/driver"
+	"github.com/thatique/awan/verr"
+)
+
+// pooledTransport hands out up to Options.MaxConnections kept alive
+// connections to concurrent Send calls.
+type pooledTransport struct {
+	mu     sync.Mutex
+	closed bool
+
+	conns []*smtpTransport
+	idle  chan *smtpTransport
+}
+
+func newPooledTransport(option *Options) (*pooledTransport, error) {
+	connOption := *option
+	connOption.KeepAlive = true
+
+	p := &pooledTransport{
+		conns: make([]*smtpTransport, option.MaxConnections),
+		idle:  make(chan *smtpTransport, option.MaxConnections),
+	}
+	for i := range p.conns {
+		// connections are dialed lazily by the first Send using them
+		conn, err := newSMTPTransport(&connOption)
+		if err != nil {
+			return nil, err
+		}
+		p.conns[i] = conn
+		p.idle <- conn
+	}
+	return p, nil
+}
+
+func (p *pooledTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
+	var conn *smtpTransport
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case conn = <-p.idle:
+	}
+	defer func() { p.idle <- conn }()
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrAlreadyClosed
+	}
+
+	return conn.Send(ctx, from, to, msg)
+}
+
+// Close waits for in-flight sends to finish, then quits all the connections.
+func (p *pooledTransport) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	var errs []error
+	for range p.conns {
+		conn := <-p.idle
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, conn := range p.conns {
+		p.idle <- conn
+	}
+
+	if agg := verr.NewAggregate(errs); agg != nil {
+		return agg
+	}
+	return nil
+}
+
+func (p *pooledTransport) ErrorCode(err error) verr.ErrorCode {
+	return p.conns[0].ErrorCode(err)
+}
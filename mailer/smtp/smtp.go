@@ -4,11 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"io"
 	"net"
 	"net/smtp"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/thatique/awan/mailer"
 	"github.com/thatique/awan/mailer/driver"
@@ -26,6 +29,10 @@ var (
 // Scheme is constant for our scheme when using URL opener
 const Scheme = "smtp"
 
+// DefaultIdleTimeout is how long a kept alive connection may stay unused before
+// it is re-dialed, when Options.IdleTimeout is not set.
+const DefaultIdleTimeout = 30 * time.Second
+
 func init() {
 	mailer.DefaultURLMux().RegisterTransport(Scheme, new(URLOpener))
 }
@@ -51,6 +58,13 @@ func (uo *URLOpener) OpenTransportURL(ctx context.Context, u *url.URL) (*mailer.
 
 // NewTransport create ne instance of `mailer.Transport` using SMTP backend
 func NewTransport(options *Options) (*mailer.Transport, error) {
+	if options.MaxConnections > 1 {
+		pool, err := newPooledTransport(options)
+		if err != nil {
+			return nil, err
+		}
+		return mailer.NewTransport(pool), nil
+	}
 	dr, err := newSMTPTransport(options)
 	if err != nil {
 		return nil, err
@@ -66,13 +80,34 @@ type Options struct {
 	Username string
 	// Password is the password to use to authenticate to the SMTP server.
 	Password string
+	// KeepAlive keeps the authenticated connection open across Send calls
+	// instead of dialing the server for every message.
+	KeepAlive bool
+	// IdleTimeout is how long a kept alive connection may stay unused before
+	// it is re-dialed. Zero means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// MaxConnections allows up to this many connections to be used by
+	// concurrent Send calls. Pooled connections are always kept alive.
+	MaxConnections int
+	// TLSConfig is used for STARTTLS, e.g. to provide RootCAs or to disable
+	// verification. ServerName defaults to the host of Addr.
+	TLSConfig *tls.Config
+	// RequireTLS fails with ErrTLSRequired when the server doesn't offer
+	// STARTTLS, instead of sending in clear text.
+	RequireTLS bool
 }
 
 type smtpTransport struct {
-	locker sync.Mutex
-	conn   *smtp.Client
-	closed bool
-	option *Options
+	locker   sync.Mutex
+	conn     *smtp.Client
+	closed   bool
+	option   *Options
+	lastUsed time.Time
+
+	// netMu guards netConn, the socket under conn, so a canceled Send can
+	// interrupt the I/O of the send holding locker
+	netMu   sync.Mutex
+	netConn net.Conn
 
 	serverName string
 }
@@ -89,22 +124,55 @@ func newSMTPTransport(option *Options) (*smtpTransport, error) {
 
 func (t *smtpTransport) Send(ctx context.Context, from string, to []string, msg driver.WriterTo) error {
 	c := make(chan error, 1)
-	go func() { c <- t.send(from, to, msg) }()
+	locked := make(chan struct{})
+	go func() { c <- t.send(ctx, locked, from, to, msg) }()
 
 	select {
 	case <-ctx.Done():
-		<-c
+		select {
+		case <-locked:
+			// send owns the connection and interrupts its I/O, wait for it
+			// to drop the connection
+			<-c
+		default:
+			// still queued behind another Send, send gives up once it gets
+			// the lock without touching the connection
+		}
 		return ctx.Err()
 	case err := <-c:
 		return err
 	}
 }
 
-func (t *smtpTransport) send(from string, to []string, msg driver.WriterTo) (err error) {
+func (t *smtpTransport) send(ctx context.Context, locked chan<- struct{}, from string, to []string, msg driver.WriterTo) (err error) {
 	t.locker.Lock()
+	close(locked)
+	if err = ctx.Err(); err != nil {
+		t.locker.Unlock()
+		return err
+	}
+
+	// unblock the in-flight reads and writes once ctx is done, the deferred
+	// func then drops the connection
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			t.setDeadline(ctx)
+		case <-stop:
+		}
+	}()
 	defer func() {
-		// close connection after this
-		t.closeSMTPConnection()
+		close(stop)
+		<-stopped
+		// keep the connection only when asked to and it's in a clean state
+		if t.option.KeepAlive && err == nil {
+			t.lastUsed = time.Now()
+			t.setDeadline(context.Background())
+		} else {
+			t.closeSMTPConnection()
+		}
 		t.locker.Unlock()
 	}()
 
@@ -112,7 +180,7 @@ func (t *smtpTransport) send(from string, to []string, msg driver.WriterTo) (err
 		return ErrAlreadyClosed
 	}
 
-	if err = t.open(); err != nil {
+	if err = t.connect(ctx); err != nil {
 		return
 	}
 
@@ -157,12 +225,72 @@ func (t *smtpTransport) closeSMTPConnection() error {
 	}
 
 	err := t.conn.Quit()
+	if err != nil {
+		// the server may already be gone, make sure the socket is released
+		t.conn.Close()
+	}
 	t.conn = nil
+	t.netMu.Lock()
+	t.netConn = nil
+	t.netMu.Unlock()
 	return err
 }
 
-func (t *smtpTransport) open() error {
-	c, err := smtp.Dial(t.option.Addr)
+// setDeadline sets the deadline of ctx on the connection, or a deadline in the
+// past once ctx is done, so the pending I/O fails right away. A ctx without
+// deadline clears it.
+func (t *smtpTransport) setDeadline(ctx context.Context) {
+	t.netMu.Lock()
+	defer t.netMu.Unlock()
+	if t.netConn == nil {
+		return
+	}
+	deadline, _ := ctx.Deadline()
+	if ctx.Err() != nil {
+		deadline = time.Unix(1, 0)
+	}
+	t.netConn.SetDeadline(deadline)
+}
+
+// connect reuses the kept alive connection if it's still usable, otherwise
+// opens a new one.
+func (t *smtpTransport) connect(ctx context.Context) error {
+	if t.conn != nil {
+		t.setDeadline(ctx)
+		idleTimeout := t.option.IdleTimeout
+		if idleTimeout <= 0 {
+			idleTimeout = DefaultIdleTimeout
+		}
+		if time.Since(t.lastUsed) < idleTimeout && t.conn.Noop() == nil {
+			return nil
+		}
+		t.closeSMTPConnection()
+	}
+
+	return t.open(ctx)
+}
+
+func (t *smtpTransport) open(ctx context.Context) (err error) {
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", t.option.Addr)
+	if err != nil {
+		return err
+	}
+	t.netMu.Lock()
+	t.netConn = netConn
+	t.netMu.Unlock()
+	defer func() {
+		if err != nil {
+			netConn.Close()
+			t.netMu.Lock()
+			t.netConn = nil
+			t.netMu.Unlock()
+		}
+	}()
+	// the handshake is bounded by ctx as well
+	t.setDeadline(ctx)
+
+	c, err := smtp.NewClient(netConn, t.serverName)
 	if err != nil {
 		return err
 	}
@@ -173,10 +301,13 @@ func (t *smtpTransport) open() error {
 
 	// Start TLS if possible
 	if ok, _ := c.Extension("STARTTLS"); ok {
-		config := &tls.Config{ServerName: t.serverName}
-		if err = c.StartTLS(config); err != nil {
+		if err = c.StartTLS(t.tlsConfig()); err != nil {
+			c.Close()
 			return err
 		}
+	} else if t.option.RequireTLS {
+		c.Close()
+		return ErrTLSRequired
 	}
 
 	// auth is non nil
@@ -210,6 +341,17 @@ func (t *smtpTransport) open() error {
 	return nil
 }
 
+func (t *smtpTransport) tlsConfig() *tls.Config {
+	if t.option.TLSConfig == nil {
+		return &tls.Config{ServerName: t.serverName}
+	}
+	config := t.option.TLSConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = t.serverName
+	}
+	return config
+}
+
 func (t *smtpTransport) ErrorCode(err error) verr.ErrorCode {
 	if err == nil {
 		return verr.OK
@@ -222,5 +364,28 @@ func (t *smtpTransport) ErrorCode(err error) verr.ErrorCode {
 		return verr.FailedPrecondition
 	}
 
+	if tperr, ok := err.(*textproto.Error); ok {
+		switch {
+		case tperr.Code >= 400 && tperr.Code < 500:
+			// transient negative completion, the command may be retried
+			return verr.Unavailable
+		case tperr.Code == 530 || tperr.Code == 535:
+			return verr.Unauthenticated
+		case tperr.Code == 550 || tperr.Code == 551:
+			return verr.NotFound
+		case tperr.Code == 552:
+			return verr.ResourceExhausted
+		case tperr.Code >= 500:
+			return verr.InvalidArgument
+		}
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return verr.Unavailable
+	}
+	if _, ok := err.(net.Error); ok {
+		return verr.Unavailable
+	}
+
 	return verr.Unknown
 }
@@ -0,0 +1,559 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/thatique/awan/mailer"
+	"github.com/thatique/awan/verr"
+)
+
+// stubServer is a minimal SMTP server accepting every message, used to observe
+// how the transport dials and talks to the server.
+type stubServer struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu        sync.Mutex
+	conns     int
+	active    int
+	maxActive int
+	messages  int
+	quits     int
+	// dropAfterMessage makes the server hang up after each accepted message
+	dropAfterMessage bool
+	// dataDelay slows down accepting each message
+	dataDelay time.Duration
+	// stallData stops reading the message after DATA until it is closed
+	stallData chan struct{}
+	// tlsConfig enables STARTTLS
+	tlsConfig *tls.Config
+	tlsConns  int
+	// mailReplies are replied to the next MAIL commands instead of accepting
+	mailReplies []string
+	mails       int
+	// dataReplies are replied to the next messages instead of queuing them
+	dataReplies []string
+	// bodies are the queued messages
+	bodies []string
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubServer{ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *stubServer) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *stubServer) counts() (conns, messages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, s.messages
+}
+
+func (s *stubServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.active++
+		if s.active > s.maxActive {
+			s.maxActive = s.active
+		}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *stubServer) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+	secured := false
+
+	reply("220 localhost ESMTP stub")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			if s.tlsConfig != nil && !secured {
+				reply("250-localhost")
+				reply("250 STARTTLS")
+			} else {
+				reply("250 localhost")
+			}
+		case strings.HasPrefix(cmd, "STARTTLS"):
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, secured = tlsConn, bufio.NewReader(tlsConn), true
+			s.mu.Lock()
+			s.tlsConns++
+			s.mu.Unlock()
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			if s.stallData != nil {
+				<-s.stallData
+				return
+			}
+			var body strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				body.WriteString(l)
+			}
+			time.Sleep(s.dataDelay)
+			s.mu.Lock()
+			if len(s.dataReplies) > 0 {
+				rep := s.dataReplies[0]
+				s.dataReplies = s.dataReplies[1:]
+				s.mu.Unlock()
+				reply(rep)
+				continue
+			}
+			s.messages++
+			s.bodies = append(s.bodies, body.String())
+			s.mu.Unlock()
+			reply("250 queued")
+			if s.dropAfterMessage {
+				return
+			}
+		case strings.HasPrefix(cmd, "MAIL"):
+			s.mu.Lock()
+			s.mails++
+			rep := "250 ok"
+			if len(s.mailReplies) > 0 {
+				rep, s.mailReplies = s.mailReplies[0], s.mailReplies[1:]
+			}
+			s.mu.Unlock()
+			reply(rep)
+		case strings.HasPrefix(cmd, "QUIT"):
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			reply("221 bye")
+			return
+		default:
+			// RCPT, NOOP, RSET
+			reply("250 ok")
+		}
+	}
+}
+
+func sendTwice(t *testing.T, tr *smtpTransport, pause time.Duration) {
+	ctx := context.Background()
+	h := make(message.Header)
+	h.Set("Subject", "test")
+	for i := 0; i < 2; i++ {
+		msg, err := message.New(h, strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			time.Sleep(pause)
+		}
+		if err := tr.Send(ctx, "from@example.com", []string{"to@example.com"}, msg); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+}
+
+func TestSendCanceledDuringData(t *testing.T) {
+	srv := newStubServer(t)
+	srv.stallData = make(chan struct{})
+	defer srv.Close()
+	defer close(srv.stallData)
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), KeepAlive: true})
+	defer tr.Close()
+
+	// large enough to fill the socket buffers, so the write blocks
+	msg, err := message.New(make(message.Header), strings.NewReader(strings.Repeat("hello world\r\n", 1<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- tr.Send(ctx, "from@example.com", []string{"to@example.com"}, msg) }()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send didn't return after the context deadline")
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	tr.locker.Lock()
+	defer tr.locker.Unlock()
+	if tr.conn != nil {
+		t.Error("expected the interrupted connection to be dropped")
+	}
+}
+
+func TestSendCanceledWhileQueued(t *testing.T) {
+	srv := newStubServer(t)
+	srv.stallData = make(chan struct{})
+	defer srv.Close()
+	defer close(srv.stallData)
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), KeepAlive: true})
+	defer tr.Close()
+
+	msg, err := message.New(make(message.Header), strings.NewReader(strings.Repeat("hello world\r\n", 1<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerCtx, cancelOwner := context.WithCancel(context.Background())
+	defer cancelOwner()
+	owner := make(chan error, 1)
+	go func() { owner <- tr.Send(ownerCtx, "from@example.com", []string{"to@example.com"}, msg) }()
+	// let the first Send take the connection and stall in DATA
+	time.Sleep(100 * time.Millisecond)
+
+	small, err := message.New(make(message.Header), strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	queued := make(chan error, 1)
+	go func() { queued <- tr.Send(ctx, "from@example.com", []string{"to@example.com"}, small) }()
+	select {
+	case err = <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued Send didn't return after the context deadline")
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	select {
+	case err = <-owner:
+		t.Fatalf("the queued Send interrupted the connection of the first one: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancelOwner()
+	if err = <-owner; err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestSendWithoutKeepAlive(t *testing.T) {
+	srv := newStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr()})
+	defer tr.Close()
+	sendTwice(t, tr, 0)
+
+	if conns, msgs := srv.counts(); conns != 2 || msgs != 2 {
+		t.Errorf("expected 2 connections and 2 messages, got %d and %d", conns, msgs)
+	}
+}
+
+func TestKeepAliveReusesConnection(t *testing.T) {
+	srv := newStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), KeepAlive: true})
+	sendTwice(t, tr, 0)
+
+	if conns, msgs := srv.counts(); conns != 1 || msgs != 2 {
+		t.Errorf("expected 1 connection and 2 messages, got %d and %d", conns, msgs)
+	}
+	if err := tr.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestKeepAliveRedialsIdleConnection(t *testing.T) {
+	srv := newStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), KeepAlive: true, IdleTimeout: time.Millisecond})
+	defer tr.Close()
+	sendTwice(t, tr, 10*time.Millisecond)
+
+	if conns, _ := srv.counts(); conns != 2 {
+		t.Errorf("expected the idle connection to be re-dialed, got %d connections", conns)
+	}
+}
+
+func TestKeepAliveRedialsDeadConnection(t *testing.T) {
+	srv := newStubServer(t)
+	srv.dropAfterMessage = true
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), KeepAlive: true})
+	defer tr.Close()
+	sendTwice(t, tr, 10*time.Millisecond)
+
+	if conns, msgs := srv.counts(); conns != 2 || msgs != 2 {
+		t.Errorf("expected 2 connections and 2 messages, got %d and %d", conns, msgs)
+	}
+}
+
+func TestPooledTransportSendsConcurrently(t *testing.T) {
+	srv := newStubServer(t)
+	srv.dataDelay = 20 * time.Millisecond
+	defer srv.Close()
+
+	tr, err := newPooledTransport(&Options{Addr: srv.Addr(), MaxConnections: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg, err := message.New(make(message.Header), strings.NewReader("hello"))
+			if err == nil {
+				err = tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.messages != n {
+		t.Errorf("expected %d messages, got %d", n, srv.messages)
+	}
+	if srv.conns > 4 {
+		t.Errorf("expected at most 4 connections, got %d", srv.conns)
+	}
+	if srv.maxActive < 2 {
+		t.Errorf("expected sends to run on several connections, max active was %d", srv.maxActive)
+	}
+	if srv.quits != srv.conns {
+		t.Errorf("expected Close to quit all %d connections, got %d quits", srv.conns, srv.quits)
+	}
+}
+
+func TestPooledTransportClosed(t *testing.T) {
+	tr, err := newPooledTransport(&Options{Addr: "127.0.0.1:0", MaxConnections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello"))
+	if err := tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg); err != ErrAlreadyClosed {
+		t.Errorf("expected ErrAlreadyClosed, got %v", err)
+	}
+}
+
+// newTLSStubServer returns a stub offering STARTTLS with httptest's
+// certificate, along with a pool trusting it.
+func newTLSStubServer(t *testing.T) (*stubServer, *x509.CertPool) {
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	srv := newStubServer(t)
+	srv.tlsConfig = &tls.Config{Certificates: ts.TLS.Certificates}
+	return srv, pool
+}
+
+func TestRequireTLSWithoutSTARTTLS(t *testing.T) {
+	srv := newStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr(), RequireTLS: true})
+	defer tr.Close()
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello"))
+	err := tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg)
+	if err != ErrTLSRequired {
+		t.Errorf("expected ErrTLSRequired, got %v", err)
+	}
+	if _, msgs := srv.counts(); msgs != 0 {
+		t.Errorf("expected nothing to be sent in clear text, got %d messages", msgs)
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	srv, pool := newTLSStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{
+		Addr:       srv.Addr(),
+		RequireTLS: true,
+		TLSConfig:  &tls.Config{RootCAs: pool},
+	})
+	defer tr.Close()
+	sendTwice(t, tr, 0)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.tlsConns != 2 || srv.messages != 2 {
+		t.Errorf("expected 2 messages over TLS, got %d messages and %d TLS connections", srv.messages, srv.tlsConns)
+	}
+}
+
+func TestSTARTTLSVerifiesCertificate(t *testing.T) {
+	srv, _ := newTLSStubServer(t)
+	defer srv.Close()
+
+	tr, _ := newSMTPTransport(&Options{Addr: srv.Addr()})
+	defer tr.Close()
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello"))
+	if err := tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg); err == nil {
+		t.Error("expected an untrusted certificate to be rejected")
+	}
+
+	tr, _ = newSMTPTransport(&Options{Addr: srv.Addr(), TLSConfig: &tls.Config{InsecureSkipVerify: true}})
+	defer tr.Close()
+	msg, _ = message.New(make(message.Header), strings.NewReader("hello"))
+	if err := tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg); err != nil {
+		t.Errorf("expected send without verification to succeed, got %v", err)
+	}
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	srv := newStubServer(t)
+	srv.mailReplies = []string{"421 try again later"}
+	defer srv.Close()
+
+	tr, err := NewTransport(&Options{Addr: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	tr = mailer.WithRetry(tr, 3, 10*time.Millisecond)
+
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello"))
+	if err = tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.mails != 2 || srv.messages != 1 {
+		t.Errorf("expected 2 attempts and 1 message, got %d and %d", srv.mails, srv.messages)
+	}
+}
+
+func TestRetryFailureAtEndOfData(t *testing.T) {
+	srv := newStubServer(t)
+	srv.dataReplies = []string{"451 try again later"}
+	defer srv.Close()
+
+	tr, err := NewTransport(&Options{Addr: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	tr = mailer.WithRetry(tr, 3, 10*time.Millisecond)
+
+	// the body of the entity can only be read once
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello world"))
+	if err = tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.mails != 2 || len(srv.bodies) != 1 {
+		t.Fatalf("expected 2 attempts and 1 message, got %d and %d", srv.mails, len(srv.bodies))
+	}
+	if !strings.Contains(srv.bodies[0], "hello world") {
+		t.Errorf("expected the retried message to be complete, got %q", srv.bodies[0])
+	}
+}
+
+func TestRetryPermanentFailure(t *testing.T) {
+	srv := newStubServer(t)
+	srv.mailReplies = []string{"554 rejected", "554 rejected"}
+	defer srv.Close()
+
+	tr, err := NewTransport(&Options{Addr: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	tr = mailer.WithRetry(tr, 3, 10*time.Millisecond)
+
+	msg, _ := message.New(make(message.Header), strings.NewReader("hello"))
+	err = tr.Send(context.Background(), "from@example.com", []string{"to@example.com"}, msg)
+	if verr.Code(err) != verr.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v (%v)", verr.Code(err), err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.mails != 1 {
+		t.Errorf("expected a permanent failure not to be retried, got %d attempts", srv.mails)
+	}
+}
@@ -13,6 +13,9 @@ var (
 
 	// ErrFileAccessDenied - cannot access file, insufficient permissions.
 	ErrFileAccessDenied = errors.New("file access denied")
+
+	// ErrDirStreamClosed - the directory stream has been closed.
+	ErrDirStreamClosed = errors.New("directory stream closed")
 )
 
 // IsSysErrNoSys check if given error is Function not implemented error
@@ -129,3 +132,21 @@ func IsSysErrCrossDevice(err error) bool {
 	e, ok := err.(*os.LinkError)
 	return ok && e.Err == syscall.EXDEV
 }
+
+// IsSysErrSharingViolation Check if the given error corresponds to
+// ERROR_ACCESS_DENIED or ERROR_SHARING_VIOLATION for windows, returned when
+// the file is open by another process.
+func IsSysErrSharingViolation(err error) bool {
+	if runtime.GOOS != "windows" {
+		return false
+	}
+	switch e := err.(type) {
+	case *os.LinkError:
+		err = e.Err
+	case *os.PathError:
+		err = e.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	// ERROR_ACCESS_DENIED, ERROR_SHARING_VIOLATION
+	return ok && (errno == 0x5 || errno == 0x20)
+}
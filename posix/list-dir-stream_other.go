@@ -0,0 +1,49 @@
+// +build plan9 solaris windows
+
+package posix
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+func openDir(dirPath string) (*os.File, error) {
+	d, err := os.Open(dirPath)
+	if err != nil {
+		// File is really not found.
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+
+		// File path cannot be verified since one of the parents is a file.
+		if strings.Contains(err.Error(), "not a directory") {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// readEntries reads the next batch of entries, at most 1000 at once.
+func (s *DirStream) readEntries() (entries []string, err error) {
+	fis, err := s.d.Readdir(1000)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		// Stat symbolic link and follow to get the final value.
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			if fi, err = os.Stat(path.Join(s.dirPath, fi.Name())); err != nil {
+				continue
+			}
+		}
+		if fi.IsDir() {
+			// Append "/" instead of "\" so that sorting is achieved as expected.
+			entries = append(entries, fi.Name()+"/")
+		} else if fi.Mode().IsRegular() {
+			entries = append(entries, fi.Name())
+		}
+	}
+	return entries, nil
+}
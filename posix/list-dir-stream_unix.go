@@ -0,0 +1,42 @@
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd
+
+package posix
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+func openDir(dirPath string) (*os.File, error) {
+	d, err := os.Open(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) || IsSysErrNotDir(err) {
+			return nil, ErrFileNotFound
+		}
+		if os.IsPermission(err) {
+			return nil, ErrFileAccessDenied
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// readEntries reads the next batch of entries, filling one ReadDirent buffer.
+func (s *DirStream) readEntries() ([]string, error) {
+	bufp := readDirBufPool.Get().(*[]byte)
+	buf := *bufp
+	defer readDirBufPool.Put(bufp)
+
+	nbuf, err := syscall.ReadDirent(int(s.d.Fd()), buf)
+	if err != nil {
+		if IsSysErrNotDir(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	if nbuf <= 0 {
+		return nil, io.EOF
+	}
+	return parseDirents(s.dirPath, buf[:nbuf])
+}
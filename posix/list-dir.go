@@ -1,5 +1,7 @@
 package posix
 
+import "os"
+
 // ReadDir return all the entries at the directory dirPath.
 func ReadDir(dirPath string) (entries []string, err error) {
 	return ReadDirN(dirPath, -1)
@@ -9,3 +11,50 @@ func ReadDir(dirPath string) (entries []string, err error) {
 func ReadDirN(dirPath string, count int) (entries []string, err error) {
 	return readDirN(dirPath, count)
 }
+
+// DirStream reads the entries of a directory incrementally, a batch at a time,
+// so huge directories can be walked without holding all the entries in
+// memory. Entries are returned in directory order, directories having a
+// trailing "/".
+type DirStream struct {
+	dirPath string
+	d       *os.File
+	pending []string
+	err     error
+}
+
+// ReadDirStream opens the directory dirPath for reading its entries with
+// Next. The returned DirStream must be closed once done.
+func ReadDirStream(dirPath string) (*DirStream, error) {
+	d, err := openDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return &DirStream{dirPath: dirPath, d: d}, nil
+}
+
+// Next returns the next entry of the directory. It returns io.EOF once all
+// the entries have been read, and ErrDirStreamClosed after Close.
+func (s *DirStream) Next() (string, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return "", s.err
+		}
+		s.pending, s.err = s.readEntries()
+	}
+	entry := s.pending[0]
+	s.pending = s.pending[1:]
+	return entry, nil
+}
+
+// Close closes the directory, any entries not read yet are discarded.
+func (s *DirStream) Close() error {
+	if s.d == nil {
+		return nil
+	}
+	err := s.d.Close()
+	s.d = nil
+	s.pending = nil
+	s.err = ErrDirStreamClosed
+	return err
+}
@@ -2,12 +2,14 @@ package posix
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -239,3 +241,83 @@ func TestReadDirN(t *testing.T) {
 		}
 	}
 }
+
+func TestReadDirStream(t *testing.T) {
+	dir := mustSetupDir(t)
+	defer os.RemoveAll(dir)
+
+	// Long names so the entries don't fit in a single read buffer.
+	const numFiles = 3000
+	prefix := strings.Repeat("x", 200)
+	for c := 0; c < numFiles; c++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%s%d", prefix, c)), []byte{}, os.ModePerm); err != nil {
+			t.Fatalf("Unable to create a file, %s", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), os.ModePerm); err != nil {
+		t.Fatalf("Unable to create a directory, %s", err)
+	}
+
+	s, err := ReadDirStream(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var entries []string
+	for {
+		entry, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 && len(s.pending)+1 >= numFiles {
+			t.Fatalf("expected entries to be read in batches, got %d at once", len(s.pending)+1)
+		}
+		entries = append(entries, entry)
+	}
+
+	expected, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(entries)
+	sort.Strings(expected)
+	if len(entries) != numFiles+1 || !checkResult(expected, entries) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+}
+
+func TestReadDirStreamClose(t *testing.T) {
+	dir := mustSetupDir(t)
+	defer os.RemoveAll(dir)
+
+	for c := 0; c < 10; c++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d", c)), []byte{}, os.ModePerm); err != nil {
+			t.Fatalf("Unable to create a file, %s", err)
+		}
+	}
+
+	s, err := ReadDirStream(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Next(); err != ErrDirStreamClosed {
+		t.Fatalf("expected = %s, got: %v", ErrDirStreamClosed, err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("expected second Close to succeed, got: %s", err)
+	}
+
+	if _, err = ReadDirStream(filepath.Join(dir, "non-existent")); err != ErrFileNotFound {
+		t.Fatalf("expected = %s, got: %v", ErrFileNotFound, err)
+	}
+}
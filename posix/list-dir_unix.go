@@ -34,19 +34,32 @@ func clen(n []byte) int {
 func parseDirents(dirPath string, buf []byte) (entries []string, err error) {
 	bufidx := 0
 	for bufidx < len(buf) {
-		dirent := (*syscall.Dirent)(unsafe.Pointer(&buf[bufidx]))
+		// Copy the record header rather than casting the buffer, the last
+		// record is shorter than syscall.Dirent and the cast would straddle
+		// the end of the buffer, which checkptr rejects under -race. The name
+		// is read from the buffer, bounded by the record.
+		var dirent syscall.Dirent
+		copy((*[unsafe.Sizeof(dirent)]byte)(unsafe.Pointer(&dirent))[:], buf[bufidx:])
 		// On non-Linux operating systems for rec length of zero means
 		// we have reached EOF break out.
 		if runtime.GOOS != "linux" && dirent.Reclen == 0 {
 			break
 		}
+		nameStart := bufidx + int(unsafe.Offsetof(dirent.Name))
 		bufidx += int(dirent.Reclen)
 		// Skip if they are absent in directory.
-		if isEmptyDirent(dirent) {
+		if isEmptyDirent(&dirent) {
 			continue
 		}
-		bytes := (*[10000]byte)(unsafe.Pointer(&dirent.Name[0]))
-		var name = string(bytes[0:clen(bytes[:])])
+		nameEnd := bufidx
+		if nameEnd > len(buf) {
+			nameEnd = len(buf)
+		}
+		if nameStart >= nameEnd {
+			continue
+		}
+		bytes := buf[nameStart:nameEnd]
+		var name = string(bytes[:clen(bytes)])
 		// Reserved names skip them.
 		if name == "." || name == ".." {
 			continue
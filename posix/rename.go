@@ -0,0 +1,28 @@
+package posix
+
+import (
+	"os"
+	"time"
+)
+
+// renameRetries is how many times AtomicRename retries a rename failing
+// because the destination is open, waiting twice as long each time starting
+// from renameBackoff.
+var (
+	renameRetries = 5
+	renameBackoff = 10 * time.Millisecond
+)
+
+// AtomicRename renames src to dst, replacing dst if it exists. On windows
+// the rename fails while another process has dst open, it is then retried
+// with a short backoff. Elsewhere it is a plain os.Rename.
+func AtomicRename(src, dst string) error {
+	err := os.Rename(src, dst)
+	backoff := renameBackoff
+	for i := 0; i < renameRetries && IsSysErrSharingViolation(err); i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = os.Rename(src, dst)
+	}
+	return err
+}
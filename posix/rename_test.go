@@ -0,0 +1,69 @@
+package posix
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAtomicRename(t *testing.T) {
+	dir := mustSetupDir(t)
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	for name, data := range map[string]string{src: "new", dst: "old"} {
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := AtomicRename(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(dst); err != nil || string(data) != "new" {
+		t.Errorf("expected dst to be replaced, got %q: %v", data, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected src to be gone, got %v", err)
+	}
+}
+
+// Renaming over an open file only fails on windows.
+func TestAtomicRenameOpenDestination(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("renaming over an open file always succeeds on " + runtime.GOOS)
+	}
+
+	dir := mustSetupDir(t)
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	for name, data := range map[string]string{src: "new", dst: "old"} {
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(src, dst); !IsSysErrSharingViolation(err) {
+		f.Close()
+		t.Fatalf("expected a sharing violation renaming over an open file, got %v", err)
+	}
+	go func() {
+		time.Sleep(2 * renameBackoff)
+		f.Close()
+	}()
+
+	if err = AtomicRename(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(dst); err != nil || string(data) != "new" {
+		t.Errorf("expected dst to be replaced, got %q: %v", data, err)
+	}
+}
@@ -29,6 +29,15 @@ type Storage interface {
 	Replace(ctx context.Context, sess *Session) error
 }
 
+// Toucher is an optional interface a Storage can implement to extend the
+// expiration of a session without rewriting its values.
+type Toucher interface {
+	// Touch mark the session with the given session ID as accessed now and
+	// make it expire in `expire` seconds. Return 'SessionDoesNotExist' if
+	// there is no session with the given session ID
+	Touch(ctx context.Context, id string, expire int) error
+}
+
 // SessionAlreadyExists returned as `error` when there already exists a session
 // with the same session ID in `Insert` operation
 type SessionAlreadyExists struct {
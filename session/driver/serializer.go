@@ -17,7 +17,14 @@ type Serializer interface {
 	Deserialize(b []byte, s *Session) error
 }
 
-// JSONSerializer serialize session values into json
+// JSONSerializer serialize session values into json. Use it with
+// redissession.Serializer(driver.JSONSerializer) when the stored sessions need
+// to be inspected or shared with other languages.
+//
+// Only string keys are supported, any other key type makes Serialize fail.
+// Values must be JSON-compatible and come back as their generic JSON
+// counterparts: numbers are decoded as float64, objects as
+// map[string]interface{} and arrays as []interface{}.
 var JSONSerializer Serializer = jsonSerializer{}
 
 type jsonSerializer struct{}
@@ -27,12 +34,16 @@ func (j jsonSerializer) Serialize(s *Session) ([]byte, error) {
 	for k, v := range s.Values {
 		ks, ok := k.(string)
 		if !ok {
-			return nil, fmt.Errorf("awan.session Non-string key value, can't serialize session to JSON: %v", k)
+			return nil, fmt.Errorf("awan.session Non-string key value, can't serialize session to JSON: %v (%T)", k, k)
 		}
 		m[ks] = v
 	}
 
-	return json.Marshal(m)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("awan.session JSONSerializer Serialize operation Error: %v", err)
+	}
+	return b, nil
 }
 
 func (j jsonSerializer) Deserialize(b []byte, s *Session) error {
@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSONSerializerRoundTrip(t *testing.T) {
+	sess := NewSession("id", "", time.Now().UTC())
+	sess.Values["name"] = "awan"
+	sess.Values["count"] = float64(3)
+	sess.Values["admin"] = true
+	sess.Values["tags"] = []interface{}{"a", "b"}
+	sess.Values["nested"] = map[string]interface{}{"k": "v"}
+
+	b, err := JSONSerializer.Serialize(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewSession("id", "", time.Now().UTC())
+	if err = JSONSerializer.Deserialize(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sess.Values, got.Values); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONSerializerRejectsNonStringKeys(t *testing.T) {
+	sess := NewSession("id", "", time.Now().UTC())
+	sess.Values[42] = "answer"
+
+	_, err := JSONSerializer.Serialize(sess)
+	if err == nil || !strings.Contains(err.Error(), "Non-string key") {
+		t.Errorf("expected a non-string key error, got: %v", err)
+	}
+}
+
+func TestJSONSerializerRejectsUnsupportedValues(t *testing.T) {
+	sess := NewSession("id", "", time.Now().UTC())
+	sess.Values["ch"] = make(chan int)
+
+	if _, err := JSONSerializer.Serialize(sess); err == nil {
+		t.Error("expected an error serializing a channel value")
+	}
+}
+
+func TestGobSerializerRoundTrip(t *testing.T) {
+	sess := NewSession("id", "", time.Now().UTC())
+	sess.Values["name"] = "awan"
+	sess.Values[42] = 7
+
+	b, err := GobSerializer.Serialize(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &Session{}
+	if err = GobSerializer.Deserialize(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sess.Values, got.Values); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
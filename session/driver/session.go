@@ -18,6 +18,10 @@ type Session struct {
 	CreatedAt time.Time
 	// AccessedAt is last time this session accessed
 	AccessedAt time.Time
+	// CreatedIP is the client IP the session was created from, if known
+	CreatedIP string
+	// UserAgent is the client user agent the session was created with, if known
+	UserAgent string
 }
 
 // NewSession create new session
@@ -33,7 +37,9 @@ func NewSession(id, authID string, now time.Time) *Session {
 
 // Equal return true if two session equal
 func (sess *Session) Equal(other *Session) bool {
-	return sess.ID == other.ID && sess.AuthID == other.AuthID && cmp.Diff(sess.Values, other.Values) == ""
+	return sess.ID == other.ID && sess.AuthID == other.AuthID &&
+		sess.CreatedIP == other.CreatedIP && sess.UserAgent == other.UserAgent &&
+		cmp.Diff(sess.Values, other.Values) == ""
 }
 
 // ExpireAt return session's expiration time with the given idle and absolute timeout
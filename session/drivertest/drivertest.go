@@ -23,6 +23,44 @@ func RunConformanceTests(t *testing.T, storage driver.Storage) {
 	t.Run("Insert Conflict", func(t *testing.T) {
 		insertSessionThrowIfExists(t, storage)
 	})
+	t.Run("Audit fields", func(t *testing.T) {
+		testAuditFields(t, storage)
+	})
+}
+
+func testAuditFields(t *testing.T, storage driver.Storage) {
+	ctx := context.Background()
+
+	sess := driver.NewSession(session.GenerateSessionID(), "", time.Now().UTC())
+	sess.CreatedIP = "192.0.2.1"
+	sess.UserAgent = "Mozilla/5.0 (X11; Linux x86_64)"
+	if err := storage.Insert(ctx, sess); err != nil {
+		t.Fatalf("failed to insert a session: %v", err)
+	}
+	defer storage.Delete(ctx, sess.ID)
+
+	sess2, err := storage.Get(ctx, sess.ID)
+	if err != nil || sess2 == nil {
+		t.Fatalf("failed to get inserted session: %v", err)
+	}
+	if sess2.CreatedIP != sess.CreatedIP || sess2.UserAgent != sess.UserAgent {
+		t.Errorf("audit fields not round-tripped, got IP %q and user agent %q", sess2.CreatedIP, sess2.UserAgent)
+	}
+
+	// sessions without audit fields stay valid
+	plain := driver.NewSession(session.GenerateSessionID(), "", time.Now().UTC())
+	if err = storage.Insert(ctx, plain); err != nil {
+		t.Fatalf("failed to insert a session: %v", err)
+	}
+	defer storage.Delete(ctx, plain.ID)
+
+	plain2, err := storage.Get(ctx, plain.ID)
+	if err != nil || plain2 == nil {
+		t.Fatalf("failed to get inserted session: %v", err)
+	}
+	if plain2.CreatedIP != "" || plain2.UserAgent != "" {
+		t.Errorf("expected empty audit fields, got IP %q and user agent %q", plain2.CreatedIP, plain2.UserAgent)
+	}
 }
 
 func testInsertGet(t *testing.T, storage driver.Storage) {
@@ -3,29 +3,87 @@ package memsession
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/thatique/awan/session"
 	"github.com/thatique/awan/session/driver"
 )
 
+// Option for storage
+type Option func(s *Storage)
+
+// IdleTimeout set idle timeout in seconds, sessions not accessed for this long
+// are considered expired
+func IdleTimeout(idle int) Option {
+	return func(s *Storage) {
+		s.idleTimeout = idle
+	}
+}
+
+// AbsoluteTimeout set absolute timeout in seconds, sessions older than this are
+// considered expired
+func AbsoluteTimeout(absolute int) Option {
+	return func(s *Storage) {
+		s.absoluteTimeout = absolute
+	}
+}
+
+// JanitorInterval starts a background goroutine that evicts expired sessions
+// every interval. Call Close to stop it.
+func JanitorInterval(interval time.Duration) Option {
+	return func(s *Storage) {
+		s.janitorInterval = interval
+	}
+}
+
 // NewServerSessionState create server session backed by memsession
 func NewServerSessionState(keyPairs ...[]byte) *session.ServerSessionState {
-	return session.NewServerSessionState(&storage{sessions: map[string]*driver.Session{}}, keyPairs...)
+	return session.NewServerSessionState(NewStorage(), keyPairs...)
 }
 
-// Storage  implements driver's storage interface that record all operations
-// performed. This is intended for testing purpose
-type storage struct {
+// Storage implements driver's storage interface by keeping the sessions in
+// memory. It is intended for tests and single-process applications.
+type Storage struct {
 	mu       sync.Mutex
 	sessions map[string]*driver.Session
+	// expires holds the deadlines given to Touch, keyed by session ID
+	expires map[string]time.Time
+
+	idleTimeout, absoluteTimeout int
+	janitorInterval              time.Duration
+
+	closeOnce sync.Once
+	donec     chan struct{}
+}
+
+// NewStorage create an in-memory storage
+func NewStorage(options ...Option) *Storage {
+	s := &Storage{
+		sessions:        map[string]*driver.Session{},
+		expires:         map[string]time.Time{},
+		idleTimeout:     604800,  // 7 days
+		absoluteTimeout: 5184000, // 60 days
+		donec:           make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.janitorInterval > 0 {
+		go s.janitor()
+	}
+	return s
 }
 
 // Get the session for the given session ID
-func (s *storage) Get(ctx context.Context, id string) (*driver.Session, error) {
+func (s *Storage) Get(ctx context.Context, id string) (*driver.Session, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if v, ok := s.sessions[id]; ok {
+		if s.isExpired(id, v, time.Now().UTC()) {
+			s.remove(id)
+			return nil, nil
+		}
 		return v, nil
 	}
 
@@ -33,19 +91,17 @@ func (s *storage) Get(ctx context.Context, id string) (*driver.Session, error) {
 }
 
 // Delete a session by id
-func (s *storage) Delete(ctx context.Context, id string) error {
+func (s *Storage) Delete(ctx context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.sessions[id]; ok {
-		delete(s.sessions, id)
-	}
+	s.remove(id)
 
 	return nil
 }
 
 // DeleteAllOfAuthID Delete all sessions of the given auth ID
-func (s *storage) DeleteAllOfAuthID(ctx context.Context, authID string) error {
+func (s *Storage) DeleteAllOfAuthID(ctx context.Context, authID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -53,6 +109,8 @@ func (s *storage) DeleteAllOfAuthID(ctx context.Context, authID string) error {
 	for k, sess := range s.sessions {
 		if sess.AuthID != authID {
 			nmap[k] = sess
+		} else {
+			delete(s.expires, k)
 		}
 	}
 
@@ -62,7 +120,7 @@ func (s *storage) DeleteAllOfAuthID(ctx context.Context, authID string) error {
 }
 
 // Insert a session to the storage
-func (s *storage) Insert(ctx context.Context, sess *driver.Session) error {
+func (s *Storage) Insert(ctx context.Context, sess *driver.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -71,18 +129,90 @@ func (s *storage) Insert(ctx context.Context, sess *driver.Session) error {
 	}
 
 	s.sessions[sess.ID] = sess
+	delete(s.expires, sess.ID)
 	return nil
 }
 
 // Replace a session with current data
-func (s *storage) Replace(ctx context.Context, sess *driver.Session) error {
+func (s *Storage) Replace(ctx context.Context, sess *driver.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if _, ok := s.sessions[sess.ID]; ok {
 		s.sessions[sess.ID] = sess
+		delete(s.expires, sess.ID)
 		return nil
 	}
 
 	return driver.SessionDoesNotExist{ID: sess.ID}
 }
+
+// Touch mark the session as accessed now and make it expire in expire seconds,
+// or earlier if the storage timeouts say so. A non-positive expire leaves the
+// expiration to the storage timeouts.
+func (s *Storage) Touch(ctx context.Context, id string, expire int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[id]; ok {
+		now := time.Now().UTC()
+		nsess := *sess
+		nsess.AccessedAt = now
+		s.sessions[id] = &nsess
+		if expire > 0 {
+			s.expires[id] = now.Add(time.Duration(expire) * time.Second)
+		} else {
+			delete(s.expires, id)
+		}
+		return nil
+	}
+
+	return driver.SessionDoesNotExist{ID: id}
+}
+
+// Close stops the janitor goroutine, if any. The stored sessions are kept.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() { close(s.donec) })
+	return nil
+}
+
+func (s *Storage) remove(id string) {
+	delete(s.sessions, id)
+	delete(s.expires, id)
+}
+
+func (s *Storage) isExpired(id string, sess *driver.Session, now time.Time) bool {
+	if deadline, ok := s.expires[id]; ok && !deadline.After(now) {
+		return true
+	}
+	if s.idleTimeout == 0 && s.absoluteTimeout == 0 {
+		return false
+	}
+	return sess.IsSessionExpired(s.idleTimeout, s.absoluteTimeout, now)
+}
+
+func (s *Storage) janitor() {
+	ticker := time.NewTicker(s.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-s.donec:
+			return
+		}
+	}
+}
+
+func (s *Storage) deleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, sess := range s.sessions {
+		if s.isExpired(id, sess, now) {
+			s.remove(id)
+		}
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 func TestConformance(t *testing.T) {
-	st := &storage{sessions: map[string]*driver.Session{}}
+	st := NewStorage()
+	defer st.Close()
 	drivertest.RunConformanceTests(t, st)
 }
 
@@ -19,7 +20,7 @@ func TestLoadSession(t *testing.T) {
 	sess := driver.NewSession("123456789-123456789-123456789-12", "auth-id", time.Now().UTC())
 	sess.Values["foo"] = "bar"
 
-	st := &storage{sessions: map[string]*driver.Session{}}
+	st := NewStorage()
 	st.Insert(context.Background(), sess)
 
 	ss := session.NewServerSessionState(st)
@@ -36,3 +37,100 @@ func TestLoadSession(t *testing.T) {
 		t.Errorf("Expected session data contains '%s' key with value 'auth-id'. Got: %v", ss.AuthKey, data)
 	}
 }
+
+func TestExpiredSession(t *testing.T) {
+	ctx := context.Background()
+	st := NewStorage(IdleTimeout(60), AbsoluteTimeout(3600))
+
+	now := time.Now().UTC()
+	idle := driver.NewSession("idle", "", now.Add(-2*time.Minute))
+	old := driver.NewSession("old", "", now.Add(-2*time.Hour))
+	old.AccessedAt = now
+	fresh := driver.NewSession("fresh", "", now)
+	for _, sess := range []*driver.Session{idle, old, fresh} {
+		if err := st.Insert(ctx, sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"idle", "old"} {
+		if sess, err := st.Get(ctx, id); err != nil || sess != nil {
+			t.Errorf("expected session %s to be expired, got: %v, %v", id, sess, err)
+		}
+	}
+	if sess, err := st.Get(ctx, "fresh"); err != nil || sess == nil {
+		t.Errorf("expected fresh session to be returned, got: %v, %v", sess, err)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	ctx := context.Background()
+	st := NewStorage(IdleTimeout(60), JanitorInterval(10*time.Millisecond))
+	defer st.Close()
+
+	expired := driver.NewSession("expired", "", time.Now().UTC().Add(-time.Hour))
+	if err := st.Insert(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		st.mu.Lock()
+		n := len(st.sessions)
+		st.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not evict the expired session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// After Close the janitor must not evict anything anymore.
+	st.Close()
+	time.Sleep(20 * time.Millisecond)
+	st.mu.Lock()
+	st.sessions["expired"] = expired
+	st.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	st.mu.Lock()
+	_, ok := st.sessions["expired"]
+	st.mu.Unlock()
+	if !ok {
+		t.Error("janitor evicted a session after Close")
+	}
+}
+
+func TestTouchExpire(t *testing.T) {
+	ctx := context.Background()
+	st := NewStorage(IdleTimeout(3600))
+
+	if err := st.Insert(ctx, driver.NewSession("touched", "", time.Now().UTC())); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().UTC()
+	if err := st.Touch(ctx, "touched", 60); err != nil {
+		t.Fatal(err)
+	}
+	st.mu.Lock()
+	deadline, ok := st.expires["touched"]
+	st.mu.Unlock()
+	if !ok || deadline.Before(before.Add(time.Minute)) || deadline.After(time.Now().UTC().Add(time.Minute)) {
+		t.Fatalf("expected Touch to expire the session in a minute, got %v, %v", deadline, ok)
+	}
+
+	// The deadline given to Touch wins over the longer idle timeout.
+	st.mu.Lock()
+	st.expires["touched"] = time.Now().UTC().Add(-time.Second)
+	st.mu.Unlock()
+	if sess, err := st.Get(ctx, "touched"); err != nil || sess != nil {
+		t.Errorf("expected touched session to be expired, got: %v, %v", sess, err)
+	}
+	st.mu.Lock()
+	_, ok = st.expires["touched"]
+	st.mu.Unlock()
+	if ok {
+		t.Error("expected the deadline to be removed with the session")
+	}
+}
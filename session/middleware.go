@@ -16,6 +16,8 @@ type sessionResponseWriter struct {
 	data       map[interface{}]interface{}
 	token      *SaveSessionToken
 	ss         *ServerSessionState
+	clientIP   string
+	userAgent  string
 }
 
 func newSessionResponseWriter(w http.ResponseWriter, token *SaveSessionToken) *sessionResponseWriter {
@@ -45,8 +47,12 @@ func Middleware(ss *ServerSessionState, next http.Handler) http.Handler {
 		nw := newSessionResponseWriter(w, token)
 		nw.data = data
 		nw.ss = ss
+		nw.clientIP = httputil.GetSourceIP(r)
+		nw.userAgent = r.UserAgent()
 
-		nr := r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, data))
+		ctx := context.WithValue(r.Context(), sessionContextKey{}, data)
+		ctx = context.WithValue(ctx, sessionTokenContextKey{}, token)
+		nr := r.WithContext(ctx)
 
 		next.ServeHTTP(nw, nr)
 	})
@@ -82,7 +88,8 @@ func (w *sessionResponseWriter) saveSession() error {
 		sess *driver.Session
 	)
 
-	if sess, err = w.ss.Save(context.Background(), w.token, w.data); err != nil {
+	ctx := WithClientInfo(context.Background(), w.clientIP, w.userAgent)
+	if sess, err = w.ss.Save(ctx, w.token, w.data); err != nil {
 		return err
 	}
 
@@ -12,6 +12,39 @@ import (
 // default session's expiration: 30 days
 const defaultSessionExpire = 86400 * 30
 
+// insertScript stores a session only when its key doesn't exist yet, so the
+// existence check and the write are atomic. It returns 0 if the session
+// already exists.
+//
+// KEYS[1] is the session key, KEYS[2] the auth set key or an empty string.
+// ARGV[1] is the expiration in seconds, followed by the hash field/value pairs.
+var insertScript = redis.NewScript(2, `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("HMSET", KEYS[1], unpack(ARGV, 2))
+redis.call("EXPIRE", KEYS[1], ARGV[1])
+if KEYS[2] ~= "" then
+	redis.call("SADD", KEYS[2], KEYS[1])
+end
+return 1
+`)
+
+// touchScript updates the access time and the expiration of a session only
+// when its key exists, so a concurrent Delete can't leave a partial hash
+// behind. It returns 0 if the session doesn't exist.
+//
+// KEYS[1] is the session key. ARGV[1] is the access time, ARGV[2] the
+// expiration in seconds.
+var touchScript = redis.NewScript(1, `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "AccessedAt", ARGV[1])
+redis.call("EXPIRE", KEYS[1], ARGV[2])
+return 1
+`)
+
 // Option for storage
 type Option func(s *storage)
 
@@ -44,9 +77,18 @@ func IdleTimeout(idle int) Option {
 }
 
 // AbsoluteTimeout set absolute timeout
-func AbsoluteTimeout(idle int) Option {
+func AbsoluteTimeout(absolute int) Option {
 	return func(s *storage) {
-		s.idleTimeout = idle
+		s.absoluteTimeout = absolute
+	}
+}
+
+// SlidingExpiration makes Get extend the session's TTL by the idle timeout,
+// without going past the absolute timeout. The TTL refresh is pipelined with
+// the read so it doesn't cost another round trip.
+func SlidingExpiration(sliding bool) Option {
+	return func(s *storage) {
+		s.slidingExpiration = sliding
 	}
 }
 
@@ -57,6 +99,7 @@ type storage struct {
 	prefix                       string
 	serializer                   driver.Serializer
 	idleTimeout, absoluteTimeout int
+	slidingExpiration            bool
 }
 
 // NewServerSessionState create new server session backed by redis
@@ -82,7 +125,41 @@ func (rs *storage) Get(ctx context.Context, id string) (*driver.Session, error)
 	}
 	defer conn.Close()
 
-	data, err := redis.Values(conn.Do("HGETALL", rs.prefix+id))
+	key := rs.prefix + id
+	if !rs.slidingExpiration {
+		reply, err := conn.Do("HGETALL", key)
+		return rs.scanSession(id, reply, err)
+	}
+
+	// EXPIRE is a no-op when the key doesn't exist
+	conn.Send("HGETALL", key)
+	conn.Send("EXPIRE", key, rs.slidingExpire())
+	if err = conn.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := conn.Receive()
+	sess, err := rs.scanSession(id, reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Receive(); err != nil || sess == nil {
+		return sess, err
+	}
+
+	// the idle timeout would keep it past its absolute timeout
+	if rs.absoluteTimeout > 0 {
+		absolute := sess.CreatedAt.Add(time.Duration(rs.absoluteTimeout) * time.Second)
+		if absolute.Before(time.Now().Add(time.Duration(rs.slidingExpire()) * time.Second)) {
+			_, err = conn.Do("EXPIREAT", key, absolute.Unix())
+		}
+	}
+	return sess, err
+}
+
+// scanSession decodes the reply of HGETALL, returning nil if the session
+// doesn't exist
+func (rs *storage) scanSession(id string, reply interface{}, err error) (*driver.Session, error) {
+	data, err := redis.Values(reply, err)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +175,14 @@ func (rs *storage) Get(ctx context.Context, id string) (*driver.Session, error)
 	return sess.toSession(id, rs.serializer)
 }
 
+// slidingExpire returns the TTL set on access by SlidingExpiration
+func (rs *storage) slidingExpire() int {
+	if rs.idleTimeout > 0 {
+		return rs.idleTimeout
+	}
+	return rs.defaultExpire
+}
+
 func (rs *storage) Delete(ctx context.Context, id string) error {
 	conn, err := rs.getConn()
 	if err != nil {
@@ -148,32 +233,21 @@ func (rs *storage) Insert(ctx context.Context, sess *driver.Session) error {
 	}
 	defer conn.Close()
 
-	key := rs.prefix + sess.ID
-	exist, err := redis.Bool(conn.Do("EXISTS", key, "AuthID"))
+	sh, err := newSessionHashFrom(sess, rs.serializer)
 	if err != nil {
 		return err
 	}
-	if exist {
-		return driver.SessionAlreadyExists{ID: sess.ID}
-	}
 
-	sh, err := newSessionHashFrom(sess, rs.serializer)
+	key := rs.prefix + sess.ID
+	args := redis.Args{}.Add(key, rs.authKey(sess.AuthID), rs.getExpire(sess)).AddFlat(sh)
+	inserted, err := redis.Bool(insertScript.Do(conn, args...))
 	if err != nil {
 		return err
 	}
-
-	conn.Send("MULTI")
-	// HMSET
-	conn.Send("HMSET", redis.Args{}.Add(key).AddFlat(sh)...)
-	conn.Send("EXPIRE", key, rs.getExpire(sess))
-
-	authKey := rs.authKey(sess.AuthID)
-	if authKey != "" {
-		conn.Send("SADD", authKey, key)
+	if !inserted {
+		return driver.SessionAlreadyExists{ID: sess.ID}
 	}
-
-	_, err = conn.Do("EXEC")
-	return err
+	return nil
 }
 
 func (rs *storage) Replace(ctx context.Context, sess *driver.Session) error {
@@ -217,6 +291,28 @@ func (rs *storage) Replace(ctx context.Context, sess *driver.Session) error {
 	return err
 }
 
+func (rs *storage) Touch(ctx context.Context, id string, expire int) error {
+	conn, err := rs.getConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if expire <= 0 {
+		expire = rs.defaultExpire
+	}
+
+	key := rs.prefix + id
+	touched, err := redis.Bool(touchScript.Do(conn, key, time.Now().UTC().Format(time.UnixDate), expire))
+	if err != nil {
+		return err
+	}
+	if !touched {
+		return driver.SessionDoesNotExist{ID: id}
+	}
+	return nil
+}
+
 func (rs *storage) authKey(authID string) string {
 	if authID != "" {
 		return rs.prefix + ":auth:" + authID
@@ -266,6 +362,10 @@ type sessionHash struct {
 	CreatedAt string
 	// When this session was last accessed in UTC
 	AccessedAt string
+	// Client IP and user agent at creation, empty for sessions stored
+	// before these were recorded
+	CreatedIP string
+	UserAgent string
 }
 
 func newSessionHashFrom(sess *driver.Session, serializer driver.Serializer) (*sessionHash, error) {
@@ -274,6 +374,8 @@ func newSessionHashFrom(sess *driver.Session, serializer driver.Serializer) (*se
 	sh.AuthID = sess.AuthID
 	sh.CreatedAt = sess.CreatedAt.Format(time.UnixDate)
 	sh.AccessedAt = sess.AccessedAt.Format(time.UnixDate)
+	sh.CreatedIP = sess.CreatedIP
+	sh.UserAgent = sess.UserAgent
 
 	bytes, err := serializer.Serialize(sess)
 	if err != nil {
@@ -305,6 +407,8 @@ func (sh *sessionHash) toSession(id string, serializer driver.Serializer) (*driv
 
 	sess.ID = id
 	sess.AuthID = sh.AuthID
+	sess.CreatedIP = sh.CreatedIP
+	sess.UserAgent = sh.UserAgent
 
 	return sess, nil
 }
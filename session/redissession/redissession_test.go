@@ -1,8 +1,12 @@
 package redissession
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -27,6 +31,247 @@ func TestConformance(t *testing.T) {
 	drivertest.RunConformanceTests(t, ss)
 }
 
+func TestConcurrentInsert(t *testing.T) {
+	cleanup, addr := prepareRedisServer()
+	defer cleanup()
+
+	ss := &storage{
+		pool:            createRedisPool(addr),
+		serializer:      driver.GobSerializer,
+		defaultExpire:   604800,
+		idleTimeout:     604800,
+		absoluteTimeout: 5184000,
+	}
+
+	const n = 50
+	var (
+		wg       sync.WaitGroup
+		inserted int32
+		errs     = make(chan error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sess := driver.NewSession("concurrent", "", time.Now().UTC())
+			sess.Values["writer"] = strconv.Itoa(i)
+			err := ss.Insert(context.Background(), sess)
+			switch err.(type) {
+			case nil:
+				atomic.AddInt32(&inserted, 1)
+			case driver.SessionAlreadyExists:
+			default:
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if inserted != 1 {
+		t.Fatalf("expected exactly one insert to succeed, got %d", inserted)
+	}
+}
+
+func TestTimeoutOptions(t *testing.T) {
+	now := time.Now().UTC()
+	testCases := []struct {
+		options []Option
+		expire  int
+	}{
+		// the session was created an hour ago and accessed just now
+		{[]Option{IdleTimeout(600)}, 600},
+		{[]Option{IdleTimeout(7200), AbsoluteTimeout(5400)}, 1800},
+		{[]Option{AbsoluteTimeout(5400), IdleTimeout(7200)}, 1800},
+		{[]Option{IdleTimeout(600), AbsoluteTimeout(5400)}, 600},
+		{[]Option{IdleTimeout(0), AbsoluteTimeout(5400)}, 1800},
+		{[]Option{AbsoluteTimeout(1800), DefaultExpire(300)}, 300},
+	}
+
+	for i, testCase := range testCases {
+		conn := &fakeConn{}
+		rs := &storage{
+			pool:            &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }},
+			serializer:      driver.GobSerializer,
+			defaultExpire:   604800,
+			idleTimeout:     604800,
+			absoluteTimeout: 5184000,
+		}
+		for _, option := range testCase.options {
+			option(rs)
+		}
+
+		sess := driver.NewSession("timeouts", "", now.Add(-time.Hour))
+		sess.AccessedAt = now
+		if err := rs.Replace(context.Background(), sess); err != nil {
+			t.Fatalf("case %d: %v", i+1, err)
+		}
+
+		expire, ok := conn.expire()
+		if !ok {
+			t.Fatalf("case %d: EXPIRE was not sent, got %v", i+1, conn.commands)
+		}
+		if expire < testCase.expire-2 || expire > testCase.expire {
+			t.Errorf("case %d: expected EXPIRE %d, got %d", i+1, testCase.expire, expire)
+		}
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	now := time.Now().UTC()
+	testCases := []struct {
+		sliding   bool
+		createdAt time.Time
+		expire    int   // EXPIRE sent with the read, 0 if none
+		expireAt  int64 // EXPIREAT capping it to the absolute timeout, 0 if none
+	}{
+		{false, now.Add(-time.Hour), 0, 0},
+		{true, now.Add(-time.Hour), 600, 0},
+		{true, now.Add(-7000 * time.Second), 600, now.Add(200 * time.Second).Unix()},
+	}
+
+	for i, testCase := range testCases {
+		sess := driver.NewSession("sliding", "", testCase.createdAt)
+		sess.AccessedAt = now
+		sh, err := newSessionHashFrom(sess, driver.GobSerializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hash []interface{}
+		for _, v := range (redis.Args{}).AddFlat(sh) {
+			hash = append(hash, []byte(fmt.Sprint(v)))
+		}
+		hash[3] = sh.Values
+
+		conn := &fakeConn{replies: map[string]interface{}{"HGETALL": hash}}
+		rs := &storage{
+			pool:            &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }},
+			serializer:      driver.GobSerializer,
+			defaultExpire:   604800,
+			idleTimeout:     600,
+			absoluteTimeout: 7200,
+		}
+		SlidingExpiration(testCase.sliding)(rs)
+
+		got, err := rs.Get(context.Background(), "sliding")
+		if err != nil {
+			t.Fatalf("case %d: %v", i+1, err)
+		}
+		if got == nil || got.ID != "sliding" {
+			t.Fatalf("case %d: expected the session, got %v", i+1, got)
+		}
+
+		expire, ok := conn.expire()
+		if ok != (testCase.expire > 0) || expire != testCase.expire {
+			t.Errorf("case %d: expected EXPIRE %d, got %d (sent: %v)", i+1, testCase.expire, expire, ok)
+		}
+		var expireAt int64
+		if args, ok := conn.sent("EXPIREAT"); ok {
+			expireAt = args[1].(int64)
+		}
+		if expireAt < testCase.expireAt-2 || expireAt > testCase.expireAt+2 {
+			t.Errorf("case %d: expected EXPIREAT %d, got %d", i+1, testCase.expireAt, expireAt)
+		}
+	}
+}
+
+func TestTouchIsAtomic(t *testing.T) {
+	for _, exists := range []bool{true, false} {
+		reply := int64(0)
+		if exists {
+			reply = 1
+		}
+		conn := &fakeConn{replies: map[string]interface{}{"EVALSHA": reply}}
+		rs := &storage{
+			pool:          &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }},
+			serializer:    driver.GobSerializer,
+			defaultExpire: 604800,
+		}
+
+		err := rs.Touch(context.Background(), "touched", 600)
+		if _, ok := err.(driver.SessionDoesNotExist); ok == exists {
+			t.Errorf("exists %v: unexpected error %v", exists, err)
+		}
+		for _, cmd := range []string{"EXISTS", "MULTI", "HSET", "EXPIRE"} {
+			if _, ok := conn.sent(cmd); ok {
+				t.Errorf("exists %v: expected Touch to run a single script, got %v", exists, conn.commands)
+			}
+		}
+		args, ok := conn.sent("EVALSHA")
+		if !ok || args[2] != "touched" || args[4] != 600 {
+			t.Errorf("exists %v: unexpected script call %v", exists, args)
+		}
+	}
+}
+
+// fakeConn records the commands sent to it and replies from replies, or with
+// an empty string to HGET, an empty array to EXEC and OK to everything else.
+type fakeConn struct {
+	commands [][]interface{}
+	replies  map[string]interface{}
+	pending  []interface{}
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	reply := c.pending[0]
+	c.pending = c.pending[1:]
+	return reply, nil
+}
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.commands = append(c.commands, append([]interface{}{cmd}, args...))
+	c.pending = append(c.pending, c.reply(cmd))
+	return nil
+}
+
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.pending = nil
+	if cmd == "" {
+		return nil, nil
+	}
+	c.commands = append(c.commands, append([]interface{}{cmd}, args...))
+	return c.reply(cmd), nil
+}
+
+func (c *fakeConn) reply(cmd string) interface{} {
+	if reply, ok := c.replies[cmd]; ok {
+		return reply
+	}
+	switch cmd {
+	case "HGET":
+		return []byte("")
+	case "EXEC":
+		return []interface{}{}
+	}
+	return "OK"
+}
+
+// sent returns the arguments of the last cmd command
+func (c *fakeConn) sent(cmd string) ([]interface{}, bool) {
+	for i := len(c.commands) - 1; i >= 0; i-- {
+		if c.commands[i][0] == cmd {
+			return c.commands[i][1:], true
+		}
+	}
+	return nil, false
+}
+
+// expire returns the seconds of the last EXPIRE command
+func (c *fakeConn) expire() (int, bool) {
+	args, ok := c.sent("EXPIRE")
+	if !ok {
+		return 0, false
+	}
+	return args[1].(int), true
+}
+
 func dial(network, address string) (redis.Conn, error) {
 	c, err := redis.Dial(network, address)
 	if err != nil {
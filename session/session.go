@@ -3,7 +3,10 @@ package session
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -40,6 +43,11 @@ const (
 const (
 	// ForceInvalidateKey is the key used to set session invalidation mode
 	ForceInvalidateKey = "_forceinvalidate_"
+
+	// RegenerateIDKey is the key used to ask for a new session ID. Unlike
+	// invalidating the current session, the session keeps its data and its
+	// creation time, so the absolute timeout is not extended.
+	RegenerateIDKey = "_regenerateid_"
 )
 
 // ServerSessionState hold some state in order to work, this struct hold all info
@@ -49,7 +57,9 @@ type ServerSessionState struct {
 	storage    driver.Storage
 	tracer     *trace.Tracer
 
-	AuthKey         string
+	AuthKey string
+	// CookieOptions of the session cookie, Secure and SameSite=Lax by
+	// default. Set Secure to false to serve sessions over plain HTTP.
 	CookieOptions   *httputil.CookieOptions
 	Codecs          []securecookie.Codec
 	IdleTimeout     int
@@ -62,6 +72,15 @@ type SaveSessionToken struct {
 	now  time.Time
 }
 
+// SessionID returns the ID of the loaded session, or an empty string if the
+// session is new and not saved yet.
+func (t *SaveSessionToken) SessionID() string {
+	if t.sess == nil {
+		return ""
+	}
+	return t.sess.ID
+}
+
 // NewServerSessionState construct a server session state
 func NewServerSessionState(storage driver.Storage, keyPairs ...[]byte) *ServerSessionState {
 	return &ServerSessionState{
@@ -76,10 +95,7 @@ func NewServerSessionState(storage driver.Storage, keyPairs ...[]byte) *ServerSe
 		IdleTimeout:     604800,  // 7 days
 		AbsoluteTimeout: 5184000, // 60 days
 		AuthKey:         "_authID",
-		CookieOptions: &httputil.CookieOptions{
-			Path:     "/",
-			HTTPOnly: true,
-		},
+		CookieOptions:   httputil.NewSecureCookieOptions(),
 	}
 }
 
@@ -105,7 +121,8 @@ func (ss *ServerSessionState) Load(ctx context.Context, cookieValue string) (dat
 		sess, err := ss.storage.Get(ctx, cookieValue)
 		if err == nil && sess != nil {
 			if !sess.IsSessionExpired(ss.IdleTimeout, ss.AbsoluteTimeout, now) {
-				return recomposeSession(ss.AuthKey, sess.AuthID, sess.Values), &SaveSessionToken{now: now, sess: sess}, err
+				data = recomposeSession(ss.AuthKey, sess.AuthID, copySessionValues(sess.Values))
+				return data, &SaveSessionToken{now: now, sess: sess}, err
 			}
 		}
 	}
@@ -126,9 +143,41 @@ func (ss *ServerSessionState) Save(ctx context.Context, token *SaveSessionToken,
 		return nil, err
 	}
 
+	if sess != nil && outputDecomp.regenerateID {
+		return ss.regenerateID(ctx, token.now, sess, outputDecomp)
+	}
+
 	return ss.saveSessionOnDb(ctx, token.now, sess, outputDecomp)
 }
 
+// Touch extends the expiration of the session loaded with the token without
+// rewriting its values. It does nothing if the token carries no session.
+func (ss *ServerSessionState) Touch(ctx context.Context, token *SaveSessionToken) (err error) {
+	ctx = ss.tracer.Start(ctx, "Touch")
+	defer func() { ss.tracer.End(ctx, err) }()
+
+	if token.sess == nil {
+		return nil
+	}
+
+	_, err = ss.touchSession(ctx, token.now, token.sess)
+	return err
+}
+
+func (ss *ServerSessionState) touchSession(ctx context.Context, now time.Time, sess *driver.Session) (*driver.Session, error) {
+	nsess := driver.NewSession(sess.ID, sess.AuthID, now)
+	nsess.CreatedAt = sess.CreatedAt
+	nsess.CreatedIP, nsess.UserAgent = sess.CreatedIP, sess.UserAgent
+	nsess.Values = sess.Values
+
+	toucher, ok := ss.storage.(driver.Toucher)
+	if !ok {
+		return nsess, ss.storage.Replace(ctx, nsess)
+	}
+
+	return nsess, toucher.Touch(ctx, nsess.ID, nsess.MaxAge(ss.IdleTimeout, ss.AbsoluteTimeout, now))
+}
+
 // Invalidates an old session ID if needed. Returns the 'Session' that should be
 // replaced when saving the session, if any.
 //
@@ -171,6 +220,27 @@ func (ss *ServerSessionState) invalidateIfNeeded(ctx context.Context, session *d
 	return session, err
 }
 
+// regenerateID moves the session to a fresh session ID, keeping its creation
+// time.
+func (ss *ServerSessionState) regenerateID(ctx context.Context, now time.Time, sess *driver.Session, dec *decomposedSession) (nsess *driver.Session, err error) {
+	ctx = ss.tracer.Start(ctx, "regenerateID")
+	defer func() { ss.tracer.End(ctx, err) }()
+
+	nsess = driver.NewSession(GenerateSessionID(), dec.authID, now)
+	nsess.CreatedAt = sess.CreatedAt
+	nsess.CreatedIP, nsess.UserAgent = sess.CreatedIP, sess.UserAgent
+	nsess.Values = dec.decomposed
+
+	// the old session is only removed once the new one is stored, so a
+	// failed insert keeps the user's session
+	if err = ss.storage.Insert(ctx, nsess); err != nil {
+		return nil, err
+	}
+	err = ss.storage.Delete(ctx, sess.ID)
+
+	return nsess, err
+}
+
 func (ss *ServerSessionState) saveSessionOnDb(ctx context.Context, now time.Time, sess *driver.Session, dec *decomposedSession) (*driver.Session, error) {
 	var err error
 
@@ -184,6 +254,7 @@ func (ss *ServerSessionState) saveSessionOnDb(ctx context.Context, now time.Time
 	if sess == nil {
 		id := GenerateSessionID()
 		sess = driver.NewSession(id, dec.authID, now)
+		sess.CreatedIP, sess.UserAgent = clientInfoFromContext(ctx)
 		sess.Values = dec.decomposed
 
 		err = ss.storage.Insert(ctx, sess)
@@ -193,8 +264,15 @@ func (ss *ServerSessionState) saveSessionOnDb(ctx context.Context, now time.Time
 
 	nsess := driver.NewSession(sess.ID, dec.authID, now)
 	nsess.CreatedAt = sess.CreatedAt
+	nsess.CreatedIP, nsess.UserAgent = sess.CreatedIP, sess.UserAgent
 	nsess.Values = dec.decomposed
 
+	// Nothing changed, only extend the session's expiration.
+	if nsess.AuthID == sess.AuthID && reflect.DeepEqual(nsess.Values, sess.Values) {
+		nsess, err = ss.touchSession(ctx, now, sess)
+		return nsess, err
+	}
+
 	err = ss.storage.Replace(ctx, nsess)
 
 	return nsess, err
@@ -203,6 +281,7 @@ func (ss *ServerSessionState) saveSessionOnDb(ctx context.Context, now time.Time
 type decomposedSession struct {
 	authID            string
 	forceInvalidation ForceInvalidate
+	regenerateID      bool
 	decomposed        map[interface{}]interface{}
 }
 
@@ -219,14 +298,89 @@ func decomposeSession(authKey string, sess map[interface{}]interface{}) *decompo
 		delete(sess, ForceInvalidateKey)
 		force = v.(ForceInvalidate)
 	}
+	_, regenerate := sess[RegenerateIDKey]
+	delete(sess, RegenerateIDKey)
 
 	return &decomposedSession{
 		authID:            authID,
 		forceInvalidation: force,
+		regenerateID:      regenerate,
 		decomposed:        sess,
 	}
 }
 
+// copySessionValues deep copies the loaded values, so changes made to nested
+// maps or slices by the handler are seen when comparing with the stored
+// session in Save.
+func copySessionValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	m := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		m[k] = deepCopy(reflect.ValueOf(v)).Interface()
+	}
+	return m
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		// nil interface
+		return reflect.ValueOf((*interface{})(nil)).Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		// unexported fields keep being shared
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+
+	return v
+}
+
 func recomposeSession(authKey, authID string, sess map[interface{}]interface{}) map[interface{}]interface{} {
 	if authID != "" {
 		sess[authKey] = authID
@@ -234,8 +388,41 @@ func recomposeSession(authKey, authID string, sess map[interface{}]interface{})
 	return sess
 }
 
-// GenerateSessionID securely
+var (
+	idGeneratorMu sync.RWMutex
+	idGenerator   = defaultIDGenerator
+)
+
+// SetIDGenerator replaces the function GenerateSessionID uses to make new
+// session IDs, and so the IDs of every session created by
+// ServerSessionState. The generator must be safe for concurrent use and return
+// unpredictable IDs, it is rejected if two successive IDs are empty or equal.
+// A nil generator restores the default of 18 random bytes, base64 encoded.
+func SetIDGenerator(gen func() string) error {
+	if gen == nil {
+		gen = defaultIDGenerator
+	}
+	if a, b := gen(), gen(); a == "" || b == "" {
+		return errors.New("awan:session: ID generator returned an empty ID")
+	} else if a == b {
+		return fmt.Errorf("awan:session: ID generator returned %q twice", a)
+	}
+
+	idGeneratorMu.Lock()
+	idGenerator = gen
+	idGeneratorMu.Unlock()
+	return nil
+}
+
+// GenerateSessionID securely, using the generator set by SetIDGenerator
 func GenerateSessionID() string {
+	idGeneratorMu.RLock()
+	gen := idGenerator
+	idGeneratorMu.RUnlock()
+	return gen()
+}
+
+func defaultIDGenerator() string {
 	return base64.URLEncoding.EncodeToString(
 		securecookie.GenerateRandomKey(18))
 }
@@ -0,0 +1,484 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/thatique/awan/httputil"
+	"github.com/thatique/awan/session/driver"
+)
+
+// recordStorage is a driver.Storage that counts the operations performed on it
+type recordStorage struct {
+	mu       sync.Mutex
+	sessions map[string]*driver.Session
+	ops      map[string]int
+}
+
+func newRecordStorage() *recordStorage {
+	return &recordStorage{sessions: map[string]*driver.Session{}, ops: map[string]int{}}
+}
+
+func (s *recordStorage) record(op string) {
+	s.ops[op]++
+}
+
+func (s *recordStorage) Get(ctx context.Context, id string) (*driver.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Get")
+	return s.sessions[id], nil
+}
+
+func (s *recordStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Delete")
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *recordStorage) DeleteAllOfAuthID(ctx context.Context, authID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("DeleteAllOfAuthID")
+	for id, sess := range s.sessions {
+		if sess.AuthID == authID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *recordStorage) Insert(ctx context.Context, sess *driver.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Insert")
+	if _, ok := s.sessions[sess.ID]; ok {
+		return driver.SessionAlreadyExists{ID: sess.ID}
+	}
+	s.sessions[sess.ID] = sess
+	return nil
+}
+
+func (s *recordStorage) Replace(ctx context.Context, sess *driver.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Replace")
+	if _, ok := s.sessions[sess.ID]; !ok {
+		return driver.SessionDoesNotExist{ID: sess.ID}
+	}
+	s.sessions[sess.ID] = sess
+	return nil
+}
+
+type touchStorage struct {
+	*recordStorage
+}
+
+func (s touchStorage) Touch(ctx context.Context, id string, expire int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Touch")
+	sess, ok := s.sessions[id]
+	if !ok {
+		return driver.SessionDoesNotExist{ID: id}
+	}
+	sess.AccessedAt = time.Now().UTC()
+	return nil
+}
+
+func insertTestSession(t *testing.T, st driver.Storage) *driver.Session {
+	sess := driver.NewSession("session-id", "auth-id", time.Now().UTC().Add(-time.Minute))
+	sess.Values["foo"] = "bar"
+	if err := st.Insert(context.Background(), sess); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestSaveUnchangedSessionTouches(t *testing.T) {
+	ctx := context.Background()
+	st := touchStorage{newRecordStorage()}
+	insertTestSession(t, st)
+
+	ss := NewServerSessionState(st)
+	data, token, err := ss.Load(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := ss.Save(ctx, token, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess == nil || sess.ID != "session-id" {
+		t.Fatalf("expected the same session to be returned, got: %v", sess)
+	}
+	if st.ops["Touch"] != 1 || st.ops["Replace"] != 0 {
+		t.Errorf("expected a single Touch and no Replace, got: %v", st.ops)
+	}
+}
+
+func TestSaveChangedSessionReplaces(t *testing.T) {
+	ctx := context.Background()
+	st := touchStorage{newRecordStorage()}
+	insertTestSession(t, st)
+
+	ss := NewServerSessionState(st)
+	data, token, err := ss.Load(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["foo"] = "baz"
+	if _, err = ss.Save(ctx, token, data); err != nil {
+		t.Fatal(err)
+	}
+	if st.ops["Touch"] != 0 || st.ops["Replace"] != 1 {
+		t.Errorf("expected a single Replace and no Touch, got: %v", st.ops)
+	}
+	if v := st.sessions["session-id"].Values["foo"]; v != "baz" {
+		t.Errorf("expected stored value to be updated, got: %v", v)
+	}
+}
+
+func TestSaveNestedChangeReplaces(t *testing.T) {
+	ctx := context.Background()
+	st := touchStorage{newRecordStorage()}
+	sess := insertTestSession(t, st)
+	sess.Values["cart"] = map[string]interface{}{"items": []interface{}{"apple"}}
+
+	ss := NewServerSessionState(st)
+	data, token, err := ss.Load(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart := data["cart"].(map[string]interface{})
+	cart["items"] = append(cart["items"].([]interface{}), "pear")
+	if _, err = ss.Save(ctx, token, data); err != nil {
+		t.Fatal(err)
+	}
+	if st.ops["Touch"] != 0 || st.ops["Replace"] != 1 {
+		t.Errorf("expected a single Replace and no Touch, got: %v", st.ops)
+	}
+	stored := st.sessions["session-id"].Values["cart"].(map[string]interface{})
+	if items := stored["items"].([]interface{}); len(items) != 2 {
+		t.Errorf("expected the nested change to be stored, got: %v", items)
+	}
+}
+
+func TestTouchFallsBackToReplace(t *testing.T) {
+	ctx := context.Background()
+	st := newRecordStorage()
+	insertTestSession(t, st)
+
+	ss := NewServerSessionState(st)
+	_, token, err := ss.Load(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ss.Touch(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if st.ops["Replace"] != 1 {
+		t.Errorf("expected Touch to fall back to Replace, got: %v", st.ops)
+	}
+}
+
+func TestRegenerateID(t *testing.T) {
+	st := newRecordStorage()
+	old := insertTestSession(t, st)
+
+	hashKey := []byte("0123456789abcdef0123456789abcdef")
+	ss := NewServerSessionState(st, hashKey)
+	if err := ss.SetCookieName("session"); err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(ss, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := GetSession(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		RegenerateID(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	encoded, err := securecookie.EncodeMulti(ss.cookieName, old.ID, ss.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: ss.cookieName, Value: encoded})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if _, ok := st.sessions[old.ID]; ok {
+		t.Error("expected the old session ID to be removed from storage")
+	}
+	if len(st.sessions) != 1 {
+		t.Fatalf("expected exactly one session in storage, got %d", len(st.sessions))
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+	var newID string
+	if err = securecookie.DecodeMulti(ss.cookieName, cookies[0].Value, &newID, ss.Codecs...); err != nil {
+		t.Fatal(err)
+	}
+	sess, ok := st.sessions[newID]
+	if !ok {
+		t.Fatalf("expected the cookie's session %q in storage", newID)
+	}
+	if newID == old.ID {
+		t.Error("expected a fresh session ID")
+	}
+	if sess.Values["foo"] != "bar" || sess.AuthID != old.AuthID {
+		t.Errorf("expected session data to be migrated, got values %v and auth ID %q", sess.Values, sess.AuthID)
+	}
+	if _, ok := sess.Values[RegenerateIDKey]; ok {
+		t.Error("RegenerateIDKey must not be persisted")
+	}
+	if !sess.CreatedAt.Equal(old.CreatedAt) {
+		t.Errorf("expected creation time %v to be kept, got %v", old.CreatedAt, sess.CreatedAt)
+	}
+}
+
+// failInsertStorage is a recordStorage failing every Insert
+type failInsertStorage struct {
+	*recordStorage
+}
+
+func (s failInsertStorage) Insert(ctx context.Context, sess *driver.Session) error {
+	return driver.SessionAlreadyExists{ID: sess.ID}
+}
+
+func TestRegenerateIDInsertFails(t *testing.T) {
+	ctx := context.Background()
+	st := failInsertStorage{newRecordStorage()}
+	old := insertTestSession(t, st.recordStorage)
+
+	ss := NewServerSessionState(st)
+	data, token, err := ss.Load(ctx, old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegenerateID(data)
+	if _, err = ss.Save(ctx, token, data); err == nil {
+		t.Fatal("expected the failed insert to be reported")
+	}
+
+	sess, ok := st.sessions[old.ID]
+	if !ok {
+		t.Fatal("expected the old session to survive the failed insert")
+	}
+	if sess.Values["foo"] != "bar" {
+		t.Errorf("expected the old session data to be kept, got %v", sess.Values)
+	}
+}
+
+func TestMiddlewareRecordsClientInfo(t *testing.T) {
+	st := newRecordStorage()
+	ss := NewServerSessionState(st, []byte("0123456789abcdef0123456789abcdef"))
+	handler := Middleware(ss, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := GetSession(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data["foo"] = "bar"
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(st.sessions) != 1 {
+		t.Fatalf("expected a new session, got %d", len(st.sessions))
+	}
+	for _, sess := range st.sessions {
+		if sess.CreatedIP != "192.0.2.1" || sess.UserAgent != "test-agent" {
+			t.Errorf("expected client info to be recorded, got IP %q and user agent %q", sess.CreatedIP, sess.UserAgent)
+		}
+	}
+}
+
+func TestMiddlewareCookieAttributes(t *testing.T) {
+	st := newRecordStorage()
+	ss := NewServerSessionState(st, []byte("0123456789abcdef0123456789abcdef"))
+	if err := ss.SetCookieName("session"); err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(ss, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := GetSession(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path == "/logout" {
+			data[ForceInvalidateKey] = CurrentSessionID
+			delete(data, "foo")
+		} else {
+			data["foo"] = "bar"
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+	checkCookieAttributes(t, rec.Header().Get("Set-Cookie"))
+
+	req := httptest.NewRequest("GET", "/logout", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	deleted := rec.Header().Get("Set-Cookie")
+	if !strings.Contains(deleted, "Max-Age=0") {
+		t.Fatalf("expected the session cookie to be deleted, got %q", deleted)
+	}
+	checkCookieAttributes(t, deleted)
+}
+
+func checkCookieAttributes(t *testing.T, setCookie string) {
+	t.Helper()
+	for _, attr := range []string{"Secure", "HttpOnly", "SameSite=Lax", "Path=/"} {
+		if !strings.Contains(setCookie, attr) {
+			t.Errorf("expected %s in %q", attr, setCookie)
+		}
+	}
+}
+
+func TestSetIDGenerator(t *testing.T) {
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	err := SetIDGenerator(func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return fmt.Sprintf("id-%d", n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetIDGenerator(nil)
+
+	st := newRecordStorage()
+	ss := NewServerSessionState(st, []byte("0123456789abcdef0123456789abcdef"))
+	handler := Middleware(ss, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := GetSession(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data["foo"] = "bar"
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// SetIDGenerator samples two IDs to validate the generator
+	if _, ok := st.sessions["id-3"]; !ok || len(st.sessions) != 1 {
+		t.Errorf("expected the session to be stored as id-3, got %v", st.sessions)
+	}
+}
+
+func TestSetIDGeneratorInvalid(t *testing.T) {
+	for _, gen := range []func() string{
+		func() string { return "" },
+		func() string { return "constant" },
+	} {
+		if err := SetIDGenerator(gen); err == nil {
+			t.Error("expected an error")
+		}
+	}
+	if id := GenerateSessionID(); len(id) != 24 {
+		t.Errorf("expected the default generator to be kept, got %q", id)
+	}
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	st := newRecordStorage()
+	old := insertTestSession(t, st)
+
+	ss := NewServerSessionState(st, []byte("0123456789abcdef0123456789abcdef"))
+	if err := ss.SetCookieName("session"); err != nil {
+		t.Fatal(err)
+	}
+	csrf := httputil.NewCSRF([]byte("csrf key"), SessionID)
+	var token string
+	handler := Middleware(ss, csrf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = csrf.Token(r)
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	encoded, err := securecookie.EncodeMulti(ss.cookieName, old.ID, ss.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, csrfToken string) int {
+		req := httptest.NewRequest(method, "/", nil)
+		req.AddCookie(&http.Cookie{Name: ss.cookieName, Value: encoded})
+		if csrfToken != "" {
+			req.Header.Set(httputil.CSRFHeaderName, csrfToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("GET", ""); code != http.StatusOK || token == "" {
+		t.Fatalf("expected a token for the session, got status %d and token %q", code, token)
+	}
+	if code := serve("POST", token); code != http.StatusOK {
+		t.Errorf("expected the session's token to be accepted, got status %d", code)
+	}
+	if code := serve("POST", ""); code != http.StatusForbidden {
+		t.Errorf("expected a missing token to be rejected, got status %d", code)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	st := newRecordStorage()
+	old := insertTestSession(t, st)
+
+	ss := NewServerSessionState(st, []byte("0123456789abcdef0123456789abcdef"))
+	if err := ss.SetCookieName("session"); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		info Info
+		ok   bool
+	)
+	handler := Middleware(ss, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok = FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	encoded, err := securecookie.EncodeMulti(ss.cookieName, old.ID, ss.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: ss.cookieName, Value: encoded})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !ok || info.ID != old.ID || !info.CreatedAt.Equal(old.CreatedAt) || !info.AccessedAt.Equal(old.AccessedAt) {
+		t.Errorf("expected the existing session %v, got %v (ok %v)", old, info, ok)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if ok {
+		t.Errorf("expected no session for a new visitor, got %v", info)
+	}
+}
@@ -1,8 +1,10 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"time"
 )
 
 // Default flashes key.
@@ -10,6 +12,27 @@ const flashesKey = "_flash"
 
 type sessionContextKey struct{}
 
+type sessionTokenContextKey struct{}
+
+type clientInfoContextKey struct{}
+
+type clientInfo struct {
+	ip, userAgent string
+}
+
+// WithClientInfo returns a context recording the client IP and user agent on
+// the sessions created by Save with it. Middleware does this for every request.
+func WithClientInfo(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, clientInfoContextKey{}, clientInfo{ip: ip, userAgent: userAgent})
+}
+
+func clientInfoFromContext(ctx context.Context) (ip, userAgent string) {
+	if info, ok := ctx.Value(clientInfoContextKey{}).(clientInfo); ok {
+		return info.ip, info.userAgent
+	}
+	return "", ""
+}
+
 // GetSession get data associated for this request. Make sure call this function after
 // `Middleware` run.
 func GetSession(r *http.Request) (map[interface{}]interface{}, error) {
@@ -22,6 +45,41 @@ func GetSession(r *http.Request) (map[interface{}]interface{}, error) {
 	return nil, errors.New("sersan: no session data found in request, perhaps you didn't use Sersan's middleware?")
 }
 
+// Info describes the session loaded by `Middleware` for a request
+type Info struct {
+	ID         string
+	CreatedAt  time.Time
+	AccessedAt time.Time
+}
+
+// FromContext returns the session loaded by `Middleware`. ok is false if the
+// request has no session yet, it is created when the response is written.
+func FromContext(ctx context.Context) (info Info, ok bool) {
+	token, _ := ctx.Value(sessionTokenContextKey{}).(*SaveSessionToken)
+	if token == nil || token.sess == nil {
+		return info, false
+	}
+	return Info{
+		ID:         token.sess.ID,
+		CreatedAt:  token.sess.CreatedAt,
+		AccessedAt: token.sess.AccessedAt,
+	}, true
+}
+
+// SessionID returns the ID of the session loaded by `Middleware` for this
+// request, or an empty string if there is none yet. It can be given to
+// httputil.NewCSRF to tie CSRF tokens to the session.
+func SessionID(r *http.Request) string {
+	info, _ := FromContext(r.Context())
+	return info.ID
+}
+
+// RegenerateID asks the session to be moved to a new session ID when it is
+// saved, keeping its data.
+func RegenerateID(sess map[interface{}]interface{}) {
+	sess[RegenerateIDKey] = true
+}
+
 // AddFlash adds a flash message to the session.
 func AddFlash(sess map[interface{}]interface{}, value interface{}, vars ...string) {
 	key := flashesKey
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"path"
 	"path/filepath"
+	"sync"
+	texttemplate "text/template"
 )
 
 // M is generic data to be passed template
@@ -55,12 +57,22 @@ func (a *assetFinder) Find(name string) (string, error) {
 	return string(b), nil
 }
 
-// Factory provides an easy way to create Template
+// executor is implemented by both html/template and text/template templates
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Factory provides an easy way to create Template. It is safe to use from
+// multiple goroutines.
 type Factory struct {
-	finder    Finder
-	funcs     template.FuncMap
-	templates map[string]*template.Template
+	finder Finder
+	funcs  template.FuncMap
+	text   bool // use text/template instead of html/template
+
+	mu        sync.RWMutex // guards templates, shared and reload
+	templates map[string]executor
 	shared    M
+	reload    bool
 }
 
 // NewFileFactory returns new Factory backed with file finder
@@ -75,34 +87,59 @@ func NewAssetFactory(basePath string, assets func(string) ([]byte, error), funcs
 
 // NewFactory returns new Factory
 func NewFactory(finder Finder, funcs template.FuncMap) *Factory {
-	return &Factory{finder: finder, funcs: funcs, templates: make(map[string]*template.Template)}
+	return &Factory{finder: finder, funcs: funcs, templates: make(map[string]executor)}
+}
+
+// NewTextFactory returns new Factory whose templates are parsed with
+// text/template, so the output is not HTML escaped. Use it to render plain
+// text such as email bodies.
+func NewTextFactory(finder Finder, funcs template.FuncMap) *Factory {
+	f := NewFactory(finder, funcs)
+	f.text = true
+	return f
 }
 
 // Make create Template
 func (f *Factory) Make(name string, tpls ...string) (*Template, error) {
-	if t, ok := f.templates[name]; ok {
+	f.mu.RLock()
+	t, ok := f.templates[name]
+	reload := f.reload
+	f.mu.RUnlock()
+	if ok && !reload {
 		return f.createTemplate(t, name), nil
 	}
 
-	var (
-		tpl *template.Template
-		err error
-	)
-
-	tpl = template.New(name).Funcs(f.funcs)
-	for _, tn := range tpls {
-		if tpl, err = f.parse(tpl, tn); err != nil {
-			return nil, err
-		}
+	tpl, err := f.parse(name, tpls)
+	if err != nil {
+		return nil, err
 	}
 
-	f.templates[name] = tpl
+	f.mu.Lock()
+	// another goroutine may have parsed it meanwhile, keep the first one
+	if t, ok := f.templates[name]; ok && !reload {
+		tpl = t
+	} else {
+		f.templates[name] = tpl
+	}
+	f.mu.Unlock()
 
 	return f.createTemplate(tpl, name), nil
 }
 
+// SetReloadOnEveryRender makes Make re-read and re-parse the templates from
+// the Finder on every call instead of using the cached ones. It is meant for
+// development, where templates are edited while the process runs.
+func (f *Factory) SetReloadOnEveryRender(reload bool) {
+	f.mu.Lock()
+	f.reload = reload
+	f.mu.Unlock()
+}
+
 // Share add a piece of shared data
 func (f *Factory) Share(k string, v interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	if f.shared == nil {
 		f.shared = M{k: v}
 	} else {
@@ -110,29 +147,51 @@ func (f *Factory) Share(k string, v interface{}) {
 	}
 }
 
-func (f *Factory) createTemplate(t *template.Template, name string) *Template {
+func (f *Factory) createTemplate(t executor, name string) *Template {
 	m := M{}
-	if f.shared != nil {
-		for k, v := range f.shared {
-			m[k] = v
-		}
+	f.mu.RLock()
+	for k, v := range f.shared {
+		m[k] = v
 	}
+	f.mu.RUnlock()
 
 	return &Template{name: name, tpl: t, data: m}
 }
 
-func (f *Factory) parse(tpl *template.Template, name string) (*template.Template, error) {
-	s, err := f.finder.Find(name)
-	if err != nil {
-		return nil, err
+func (f *Factory) parse(name string, tpls []string) (executor, error) {
+	sources := make([]string, 0, len(tpls))
+	for _, tn := range tpls {
+		s, err := f.finder.Find(tn)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+
+	var err error
+	if f.text {
+		tpl := texttemplate.New(name).Funcs(texttemplate.FuncMap(f.funcs))
+		for _, s := range sources {
+			if tpl, err = tpl.Parse(s); err != nil {
+				return nil, err
+			}
+		}
+		return tpl, nil
+	}
+
+	tpl := template.New(name).Funcs(f.funcs)
+	for _, s := range sources {
+		if tpl, err = tpl.Parse(s); err != nil {
+			return nil, err
+		}
 	}
-	return tpl.Parse(s)
+	return tpl, nil
 }
 
 // Template provides a way to compose data
 type Template struct {
 	name string
-	tpl  *template.Template
+	tpl  executor
 	data M // always non nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -83,6 +84,128 @@ func TestTemplateContextOverwrite(t *testing.T) {
 	}
 }
 
+func TestFactoryConcurrentMake(t *testing.T) {
+	factory := NewFactory(&testFinder{name: "index.html"}, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			factory.Share(fmt.Sprintf("Key%d", i), i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			tpl, err := factory.Make("index", "index.html")
+			if err != nil {
+				errs <- err
+				return
+			}
+			var buf bytes.Buffer
+			if err := tpl.Execute(&buf, M{"Title": "Awan", "Items": []string{"Test", "Get"}}); err != nil {
+				errs <- err
+				return
+			}
+			if got := buf.String(); got != want {
+				errs <- fmt.Errorf("got %q; want %q", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestFactoryReloadOnEveryRender(t *testing.T) {
+	finder := &memoryFinder{templates: map[string]string{"hello.html": "Hello {{.Name}}"}}
+	factory := NewFactory(finder, nil)
+
+	render := func() string {
+		tpl, err := factory.Make("hello", "hello.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, M{"Name": "Awan"}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if got := render(); got != "Hello Awan" {
+		t.Fatalf("got %q; want %q", got, "Hello Awan")
+	}
+	finder.set("hello.html", "Bye {{.Name}}")
+	if got := render(); got != "Hello Awan" {
+		t.Fatalf("cached template: got %q; want %q", got, "Hello Awan")
+	}
+
+	factory.SetReloadOnEveryRender(true)
+	if got := render(); got != "Bye Awan" {
+		t.Fatalf("reloaded template: got %q; want %q", got, "Bye Awan")
+	}
+	finder.set("hello.html", "Hi {{.Name}}")
+	if got := render(); got != "Hi Awan" {
+		t.Fatalf("reloaded template: got %q; want %q", got, "Hi Awan")
+	}
+	if finder.calls != 3 {
+		t.Fatalf("finder called %d times; want 3", finder.calls)
+	}
+}
+
+func TestTextFactory(t *testing.T) {
+	finder := &memoryFinder{templates: map[string]string{"body": "Hello {{.Name}}"}}
+
+	tests := []struct {
+		factory *Factory
+		want    string
+	}{
+		{NewTextFactory(finder, nil), "Hello <b>Awan</b>"},
+		{NewFactory(finder, nil), "Hello &lt;b&gt;Awan&lt;/b&gt;"},
+	}
+	for _, test := range tests {
+		tpl, err := test.factory.Make("body", "body")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, M{"Name": "<b>Awan</b>"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("got %q; want %q", got, test.want)
+		}
+	}
+}
+
+type memoryFinder struct {
+	mu        sync.Mutex
+	templates map[string]string
+	calls     int
+}
+
+func (mf *memoryFinder) set(name, tpl string) {
+	mf.mu.Lock()
+	mf.templates[name] = tpl
+	mf.mu.Unlock()
+}
+
+func (mf *memoryFinder) Find(name string) (string, error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	mf.calls++
+	tpl, ok := mf.templates[name]
+	if !ok {
+		return "", fmt.Errorf("can't find template %s", name)
+	}
+	return tpl, nil
+}
+
 type testFinder struct {
 	name string
 }
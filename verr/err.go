@@ -84,6 +84,12 @@ func (e *Error) FormatError(p xerrors.Printer) (next error) {
 	return e.err
 }
 
+// Details returns the whole chain of errors, each with the frame it was
+// created at when known, as printed by "%+v". Error only holds the messages.
+func (e *Error) Details() string {
+	return fmt.Sprintf("%+v", e)
+}
+
 // Unwrap returns the error underlying the receiver, which may be nil.
 func (e *Error) Unwrap() error {
 	return e.err
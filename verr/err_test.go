@@ -0,0 +1,30 @@
+package verr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorIncludesCause(t *testing.T) {
+	cause := errors.New("The specified key does not exist.")
+	err := New(NotFound, New(NotFound, cause, 1, "minioblob"), 1, "blob")
+
+	if got, want := err.Error(), "blob (code=NotFound): minioblob (code=NotFound): The specified key does not exist."; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	details := err.Details()
+	for _, want := range []string{"blob (code=NotFound)", "minioblob (code=NotFound)", cause.Error(), "err_test.go"} {
+		if !strings.Contains(details, want) {
+			t.Errorf("expected Details() to contain %q, got:\n%s", want, details)
+		}
+	}
+}
+
+func TestErrorWithoutMessage(t *testing.T) {
+	err := New(Unavailable, errors.New("connection refused"), 1, "")
+	if got, want := err.Error(), "code=Unavailable: connection refused"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package verr
+
+import (
+	"fmt"
+	"net/http"
+)
+
+var codeNames = map[ErrorCode]string{
+	OK:                 "OK",
+	Unknown:            "Unknown",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	InvalidArgument:    "InvalidArgument",
+	Internal:           "Internal",
+	Unimplemented:      "Unimplemented",
+	FailedPrecondition: "FailedPrecondition",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	Aborted:            "Aborted",
+	Unavailable:        "Unavailable",
+	Unauthenticated:    "Unauthenticated",
+}
+
+var codeStatuses = map[ErrorCode]int{
+	OK:                 http.StatusOK,
+	Unknown:            http.StatusInternalServerError,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	InvalidArgument:    http.StatusBadRequest,
+	Internal:           http.StatusInternalServerError,
+	Unimplemented:      http.StatusNotImplemented,
+	FailedPrecondition: http.StatusPreconditionFailed,
+	PermissionDenied:   http.StatusForbidden,
+	ResourceExhausted:  http.StatusTooManyRequests,
+	Aborted:            http.StatusConflict,
+	Unavailable:        http.StatusServiceUnavailable,
+	Unauthenticated:    http.StatusUnauthorized,
+}
+
+// String returns the name of the code, e.g. "NotFound"
+func (c ErrorCode) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// HTTPStatus returns the HTTP status code to respond with for an error of the
+// given code. Codes without a better match map to 500 Internal Server Error.
+func HTTPStatus(c ErrorCode) int {
+	if status, ok := codeStatuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// FromHTTPStatus returns the ErrorCode best describing an HTTP response
+// status, e.g. one returned by a provider's API. 2xx and 3xx statuses are OK,
+// unrecognized error statuses are Unknown.
+func FromHTTPStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable, http.StatusRequestEntityTooLarge:
+		return InvalidArgument
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return NotFound
+	case http.StatusConflict:
+		return AlreadyExists
+	case http.StatusPreconditionFailed:
+		return FailedPrecondition
+	case http.StatusTooManyRequests:
+		return ResourceExhausted
+	case http.StatusInternalServerError:
+		return Internal
+	case http.StatusNotImplemented:
+		return Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Unavailable
+	}
+
+	if status >= 200 && status < 400 {
+		return OK
+	}
+	return Unknown
+}
@@ -0,0 +1,76 @@
+package verr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	testCases := []struct {
+		code   ErrorCode
+		name   string
+		status int
+		// back is FromHTTPStatus(status), which differs from code when
+		// several codes share a status
+		back ErrorCode
+	}{
+		{OK, "OK", http.StatusOK, OK},
+		{Unknown, "Unknown", http.StatusInternalServerError, Internal},
+		{NotFound, "NotFound", http.StatusNotFound, NotFound},
+		{AlreadyExists, "AlreadyExists", http.StatusConflict, AlreadyExists},
+		{InvalidArgument, "InvalidArgument", http.StatusBadRequest, InvalidArgument},
+		{Internal, "Internal", http.StatusInternalServerError, Internal},
+		{Unimplemented, "Unimplemented", http.StatusNotImplemented, Unimplemented},
+		{FailedPrecondition, "FailedPrecondition", http.StatusPreconditionFailed, FailedPrecondition},
+		{PermissionDenied, "PermissionDenied", http.StatusForbidden, PermissionDenied},
+		{ResourceExhausted, "ResourceExhausted", http.StatusTooManyRequests, ResourceExhausted},
+		{Aborted, "Aborted", http.StatusConflict, AlreadyExists},
+		{Unavailable, "Unavailable", http.StatusServiceUnavailable, Unavailable},
+		{Unauthenticated, "Unauthenticated", http.StatusUnauthorized, Unauthenticated},
+	}
+
+	if len(testCases) != len(codeNames) {
+		t.Fatalf("expected a test case for each of the %d codes, got %d", len(codeNames), len(testCases))
+	}
+	for _, testCase := range testCases {
+		if got := testCase.code.String(); got != testCase.name {
+			t.Errorf("%d.String() = %q, want %q", int(testCase.code), got, testCase.name)
+		}
+		if got := HTTPStatus(testCase.code); got != testCase.status {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", testCase.code, got, testCase.status)
+		}
+		if got := FromHTTPStatus(testCase.status); got != testCase.back {
+			t.Errorf("FromHTTPStatus(%d) = %v, want %v", testCase.status, got, testCase.back)
+		}
+	}
+}
+
+func TestUndefinedCode(t *testing.T) {
+	c := ErrorCode(99)
+	if got := c.String(); got != "ErrorCode(99)" {
+		t.Errorf("got %q", got)
+	}
+	if got := HTTPStatus(c); got != http.StatusInternalServerError {
+		t.Errorf("got %d", got)
+	}
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	testCases := []struct {
+		status int
+		want   ErrorCode
+	}{
+		{http.StatusNoContent, OK},
+		{http.StatusNotModified, OK},
+		{http.StatusGone, NotFound},
+		{http.StatusRequestedRangeNotSatisfiable, InvalidArgument},
+		{http.StatusGatewayTimeout, Unavailable},
+		{http.StatusTeapot, Unknown},
+		{599, Unknown},
+	}
+	for _, testCase := range testCases {
+		if got := FromHTTPStatus(testCase.status); got != testCase.want {
+			t.Errorf("FromHTTPStatus(%d) = %v, want %v", testCase.status, got, testCase.want)
+		}
+	}
+}
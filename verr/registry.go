@@ -0,0 +1,75 @@
+package verr
+
+import "sync"
+
+// S3 is the name of the registry holding the error codes returned by S3
+// compatible services, shared by the drivers talking to them.
+const S3 = "s3"
+
+var (
+	registryMu sync.RWMutex
+	registries = map[string]map[string]ErrorCode{}
+)
+
+func init() {
+	RegisterProviderCodes(S3, map[string]ErrorCode{
+		"AccessDenied":            PermissionDenied,
+		"AccountProblem":          PermissionDenied,
+		"AllAccessDisabled":       PermissionDenied,
+		"InvalidAccessKeyId":      Unauthenticated,
+		"SignatureDoesNotMatch":   Unauthenticated,
+		"ExpiredToken":            Unauthenticated,
+		"NoSuchKey":               NotFound,
+		"NoSuchBucket":            NotFound,
+		"NoSuchUpload":            NotFound,
+		"NoSuchVersion":           NotFound,
+		"NotFound":                NotFound,
+		"BucketAlreadyExists":     AlreadyExists,
+		"BucketAlreadyOwnedByYou": AlreadyExists,
+		"InvalidArgument":         InvalidArgument,
+		"InvalidBucketName":       InvalidArgument,
+		"InvalidRange":            InvalidArgument,
+		"KeyTooLongError":         InvalidArgument,
+		"EntityTooLarge":          InvalidArgument,
+		"EntityTooSmall":          InvalidArgument,
+		"MalformedXML":            InvalidArgument,
+		"InvalidDigest":           InvalidArgument,
+		"BadDigest":               InvalidArgument,
+		"PreconditionFailed":      FailedPrecondition,
+		"BucketNotEmpty":          FailedPrecondition,
+		"NotImplemented":          Unimplemented,
+		"InternalError":           Internal,
+		"SlowDown":                ResourceExhausted,
+		"ServiceUnavailable":      Unavailable,
+		"RequestTimeout":          Unavailable,
+		"OperationAborted":        Aborted,
+	})
+}
+
+// RegisterProviderCodes adds the given provider error codes to the named
+// registry, creating it if needed. Codes already registered are overwritten.
+func RegisterProviderCodes(registryName string, codes map[string]ErrorCode) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry, ok := registries[registryName]
+	if !ok {
+		registry = make(map[string]ErrorCode, len(codes))
+		registries[registryName] = registry
+	}
+	for code, c := range codes {
+		registry[code] = c
+	}
+}
+
+// FromProviderCode returns the ErrorCode registered for the provider's code in
+// the named registry, or Unknown if there is none.
+func FromProviderCode(registryName, code string) ErrorCode {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if c, ok := registries[registryName][code]; ok {
+		return c
+	}
+	return Unknown
+}
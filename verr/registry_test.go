@@ -0,0 +1,32 @@
+package verr
+
+import "testing"
+
+func TestFromProviderCode(t *testing.T) {
+	RegisterProviderCodes("test", map[string]ErrorCode{
+		"Gone":  NotFound,
+		"Taken": AlreadyExists,
+	})
+	RegisterProviderCodes("test", map[string]ErrorCode{
+		"Gone": Internal,
+	})
+
+	tests := []struct {
+		registry, code string
+		want           ErrorCode
+	}{
+		{S3, "AccessDenied", PermissionDenied},
+		{S3, "NoSuchKey", NotFound},
+		{S3, "SlowDown", ResourceExhausted},
+		{S3, "ServiceUnavailable", Unavailable},
+		{S3, "SomethingNew", Unknown},
+		{"test", "Gone", Internal},
+		{"test", "Taken", AlreadyExists},
+		{"missing", "NoSuchKey", Unknown},
+	}
+	for _, test := range tests {
+		if got := FromProviderCode(test.registry, test.code); got != test.want {
+			t.Errorf("FromProviderCode(%q, %q) = %v, want %v", test.registry, test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package verr
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+)
+
+// Retryable returns true if an operation failing with this code may succeed
+// when retried later: Unavailable, ResourceExhausted and Aborted.
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case Unavailable, ResourceExhausted, Aborted:
+		return true
+	}
+	return false
+}
+
+// IsRetryable returns true if err, or some error it wraps, is an *Error with a
+// retryable code. Context cancellation and deadline errors are never
+// retryable, nor are errors not carrying a code.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if xerrors.Is(err, context.Canceled) || xerrors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var e *Error
+	if !xerrors.As(err, &e) {
+		return false
+	}
+	return e.Code.Retryable()
+}
@@ -0,0 +1,45 @@
+package verr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestRetryable(t *testing.T) {
+	retryable := map[ErrorCode]bool{Unavailable: true, ResourceExhausted: true, Aborted: true}
+	for code := range codeNames {
+		if got := code.Retryable(); got != retryable[code] {
+			t.Errorf("%v.Retryable() = %v, want %v", code, got, retryable[code])
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	base := errors.New("boom")
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bare", base, false},
+		{"unavailable", New(Unavailable, base, 1, ""), true},
+		{"resource exhausted", New(ResourceExhausted, base, 1, ""), true},
+		{"aborted", New(Aborted, nil, 1, ""), true},
+		{"invalid argument", New(InvalidArgument, base, 1, ""), false},
+		{"not found", New(NotFound, base, 1, ""), false},
+		{"permission denied", New(PermissionDenied, base, 1, ""), false},
+		{"wrapped unavailable", xerrors.Errorf("send: %w", New(Unavailable, base, 1, "")), true},
+		{"wrapped not found", xerrors.Errorf("send: %w", New(NotFound, base, 1, "")), false},
+		{"canceled", context.Canceled, false},
+		{"deadline in error", New(Unavailable, context.DeadlineExceeded, 1, ""), false},
+	}
+	for _, testCase := range testCases {
+		if got := IsRetryable(testCase.err); got != testCase.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", testCase.name, testCase.err, got, testCase.want)
+		}
+	}
+}